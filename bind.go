@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// bindStatement is one statement in a BIND configuration file, such as
+// `key "name" { algorithm hmac-sha256; };`. args are the words before the block
+// or the semicolon, with quotes removed, and block holds the statements between
+// the braces.
+type bindStatement struct {
+	args  []string
+	block []bindStatement
+}
+
+// arg returns the argument at i, or "" when the statement is shorter.
+func (s bindStatement) arg(i int) string {
+	if i >= len(s.args) {
+		return ""
+	}
+
+	return s.args[i]
+}
+
+// parseBind parses the statements in a BIND configuration file. It knows the
+// syntax but not the meaning of any statement, so named.conf and the key files
+// from tsig-keygen both parse. An error names only the first word of the
+// statement, because the rest of it can be a secret.
+func parseBind(data string) ([]bindStatement, error) {
+	tokens, err := bindTokens(data)
+	if err != nil {
+		return nil, err
+	}
+
+	statements, rest, err := parseBindBlock(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, errors.New("unexpected }")
+	}
+
+	return statements, nil
+}
+
+// parseBindBlock parses statements until the end of the tokens or a closing
+// brace, and returns the tokens after them.
+func parseBindBlock(tokens []bindToken) ([]bindStatement, []bindToken, error) {
+	var statements []bindStatement
+
+	for len(tokens) > 0 {
+		if tokens[0].is("}") {
+			return statements, tokens, nil
+		}
+
+		var stmt bindStatement
+
+		for len(tokens) > 0 && !tokens[0].is(";") && !tokens[0].is("{") && !tokens[0].is("}") {
+			stmt.args = append(stmt.args, tokens[0].text)
+			tokens = tokens[1:]
+		}
+
+		if len(tokens) == 0 {
+			return nil, nil, fmt.Errorf("%q statement is missing a ;", stmt.arg(0))
+		}
+
+		if tokens[0].is("{") {
+			block, rest, err := parseBindBlock(tokens[1:])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("%q statement is missing a }", stmt.arg(0))
+			}
+
+			stmt.block = block
+			tokens = rest[1:]
+
+			if len(tokens) == 0 || !tokens[0].is(";") {
+				return nil, nil, fmt.Errorf("%q statement is missing a ; after the }", stmt.arg(0))
+			}
+		}
+
+		if tokens[0].is("}") {
+			return nil, nil, fmt.Errorf("%q statement is missing a ;", stmt.arg(0))
+		}
+
+		// Skip the semicolon.
+		tokens = tokens[1:]
+
+		// An empty statement is a stray semicolon, which BIND accepts.
+		if len(stmt.args) > 0 || stmt.block != nil {
+			statements = append(statements, stmt)
+		}
+	}
+
+	return statements, nil, nil
+}
+
+// bindToken is a word, a quoted string or one of the characters { } ;. A quoted
+// "{" is a word, so the parser must not take it for a brace.
+type bindToken struct {
+	text   string
+	quoted bool
+}
+
+func (t bindToken) is(punct string) bool {
+	return !t.quoted && t.text == punct
+}
+
+// bindTokens splits a BIND configuration file into tokens, and drops the
+// comments in all three styles that BIND accepts.
+func bindTokens(data string) ([]bindToken, error) {
+	var tokens []bindToken
+
+	for len(data) > 0 {
+		switch {
+		case strings.HasPrefix(data, "#"), strings.HasPrefix(data, "//"):
+			end := strings.IndexByte(data, '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+
+			data = data[end+1:]
+
+		case strings.HasPrefix(data, "/*"):
+			end := strings.Index(data, "*/")
+			if end < 0 {
+				return nil, errors.New("comment is missing its closing */")
+			}
+
+			data = data[end+2:]
+
+		case data[0] == '"':
+			end := strings.IndexByte(data[1:], '"')
+			if end < 0 {
+				return nil, errors.New("string is missing its closing quote")
+			}
+
+			tokens = append(tokens, bindToken{text: data[1 : end+1], quoted: true})
+			data = data[end+2:]
+
+		case strings.IndexByte("{};", data[0]) >= 0:
+			tokens = append(tokens, bindToken{text: data[:1]})
+			data = data[1:]
+
+		case strings.IndexByte(" \t\r\n", data[0]) >= 0:
+			data = data[1:]
+
+		default:
+			end := strings.IndexAny(data, " \t\r\n{};\"#")
+			if end < 0 {
+				end = len(data)
+			}
+
+			tokens = append(tokens, bindToken{text: data[:end]})
+			data = data[end:]
+		}
+	}
+
+	return tokens, nil
+}
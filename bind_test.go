@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBind(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    string
+		want    []bindStatement
+		wantErr bool
+	}{
+		{
+			name: "key file",
+			data: keygenOutput,
+			want: []bindStatement{{
+				args: []string{"key", "transfer"},
+				block: []bindStatement{
+					{args: []string{"algorithm", "hmac-sha256"}},
+					{args: []string{"secret", testSecret}},
+				},
+			}},
+		},
+		{
+			name: "comments in all three styles",
+			data: "# hash\n// slashes\n/* a\nblock */ include \"/etc/bind/zones.conf\"; // trailing",
+			want: []bindStatement{{args: []string{"include", "/etc/bind/zones.conf"}}},
+		},
+		{
+			name: "nested blocks and a quoted brace",
+			data: `zone "example.com" in { type primary; also-notify { 192.0.2.1; }; description "{"; };`,
+			want: []bindStatement{{
+				args: []string{"zone", "example.com", "in"},
+				block: []bindStatement{
+					{args: []string{"type", "primary"}},
+					{args: []string{"also-notify"}, block: []bindStatement{{args: []string{"192.0.2.1"}}}},
+					{args: []string{"description", "{"}},
+				},
+			}},
+		},
+		{name: "missing semicolon", data: `include "x"`, wantErr: true},
+		{name: "missing semicolon after block", data: `key "k" { secret "x"; }`, wantErr: true},
+		{name: "missing closing brace", data: `key "k" { secret "x";`, wantErr: true},
+		{name: "stray closing brace", data: `};`, wantErr: true},
+		{name: "unterminated string", data: `secret "x;`, wantErr: true},
+		{name: "unterminated comment", data: `/* secret`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBind(tt.data)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseBind(%q) = %v, want error", tt.data, got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseBind(%q) returned error: %v", tt.data, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseBind(%q) = %+v, want %+v", tt.data, got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// catalogVersions are the catalog zone schema versions the exporter reads. Both
+// list member zones the same way. RFC 9432 forbids reading a catalog of any
+// other version, because its layout is unknown.
+var catalogVersions = map[string]bool{
+	"1": true,
+	"2": true,
+}
+
+// catalogMembers transfers a catalog zone and returns a zone for every member
+// it lists.
+func (e *Exporter) catalogMembers(ctx context.Context, catalog Catalog) ([]Zone, error) {
+	origin := dns.CanonicalName(catalog.Zone)
+	version := "version." + origin
+	members := "zones." + origin
+
+	var (
+		versions []string
+		names    []string
+	)
+
+	server := e.zoneServer(catalog.member(catalog.Zone))
+
+	_, err := e.axfr(ctx, catalog.Zone, catalog.Key, server, func(rr dns.RR) {
+		owner := dns.CanonicalName(rr.Header().Name)
+
+		switch rr := rr.(type) {
+		case *dns.TXT:
+			if owner == version {
+				versions = append(versions, strings.Join(rr.Txt, ""))
+			}
+
+		case *dns.PTR:
+			// A member is a PTR at <unique-id>.zones.<catalog>. PTRs below it are
+			// properties of the member, not members.
+			if dns.IsSubDomain(members, owner) && dns.CountLabel(owner) == dns.CountLabel(members)+1 {
+				names = append(names, rr.Ptr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) != 1 {
+		return nil, errors.New("the catalog must have exactly one version TXT record")
+	}
+
+	if !catalogVersions[versions[0]] {
+		return nil, fmt.Errorf("the catalog has schema version %q, which the exporter cannot read", versions[0])
+	}
+
+	zones := make([]Zone, 0, len(names))
+	for _, name := range names {
+		zones = append(zones, catalog.member(zoneLabel(name)))
+	}
+
+	return zones, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// catalogZone builds a catalog zone called name with the schema version and
+// the member zones given, ready to serve over AXFR.
+func catalogZone(name, version string, members ...string) []dns.RR {
+
+	soa := &dns.SOA{
+		Hdr:     dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 0},
+		Ns:      "invalid.",
+		Mbox:    "invalid.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  0,
+	}
+
+	records := []dns.RR{
+		soa,
+		&dns.NS{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNS, Class: dns.ClassINET}, Ns: "invalid."},
+		&dns.TXT{Hdr: dns.RR_Header{Name: "version." + name, Rrtype: dns.TypeTXT, Class: dns.ClassINET}, Txt: []string{version}},
+	}
+
+	for i, member := range members {
+		owner := fmt.Sprintf("m%d.zones.%s", i, name)
+
+		records = append(records,
+			&dns.PTR{Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypePTR, Class: dns.ClassINET}, Ptr: member},
+			// A property of the member, which must not be read as a member.
+			&dns.PTR{Hdr: dns.RR_Header{Name: "coo." + owner, Rrtype: dns.TypePTR, Class: dns.ClassINET}, Ptr: "other.catalog."},
+		)
+	}
+
+	return append(records, soa)
+}
+
+func TestCatalogMembersAreMonitored(t *testing.T) {
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{time.Unix(2000000000, 0)},
+		zones: map[string][]dns.RR{
+			"catalog.invalid.": catalogZone("catalog.invalid.", "2", "example.com.", "missing.example."),
+		},
+	})
+
+	defer cancel()
+
+	e := NewDNSSECExporter(2*time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	e.Catalogs = []Catalog{{Zone: "catalog.invalid", Server: addr}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	// The server has no missing.example zone, so its transfer fails.
+	expected := `
+# HELP dnssec_discovery_success Did the last attempt to read the zones from the source succeed
+# TYPE dnssec_discovery_success gauge
+dnssec_discovery_success{discovery="catalog",source="catalog.invalid"} 1
+# HELP dnssec_discovery_zones Number of zones that the source lists
+# TYPE dnssec_discovery_zones gauge
+dnssec_discovery_zones{discovery="catalog",source="catalog.invalid"} 2
+# HELP dnssec_zone_transfer_success Did the zone transfer from the configured server succeed
+# TYPE dnssec_zone_transfer_success gauge
+dnssec_zone_transfer_success{server="` + addr + `",zone="example.com"} 1
+dnssec_zone_transfer_success{server="` + addr + `",zone="missing.example"} 0
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"dnssec_discovery_success", "dnssec_discovery_zones", "dnssec_zone_transfer_success"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+// A member that also has a [[zones]] entry must be transferred once, with the
+// settings of the entry.
+func TestCatalogMemberWithZonesEntry(t *testing.T) {
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{time.Unix(2000000000, 0)},
+		zones: map[string][]dns.RR{
+			"catalog.invalid.": catalogZone("catalog.invalid.", "2", "example.com."),
+		},
+	})
+
+	defer cancel()
+
+	e := NewDNSSECExporter(2*time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	e.Zones = []Zone{{Zone: "example.com", Server: addr, Labels: map[string]string{"team": "dns"}}}
+	e.Catalogs = []Catalog{{Zone: "catalog.invalid", Server: addr}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	expected := `
+# HELP dnssec_zone_transfer_success Did the zone transfer from the configured server succeed
+# TYPE dnssec_zone_transfer_success gauge
+dnssec_zone_transfer_success{server="` + addr + `",team="dns",zone="example.com"} 1
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "dnssec_zone_transfer_success"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+// A catalog of an unknown schema version must not be read, because its layout
+// is unknown.
+func TestCatalogUnknownVersion(t *testing.T) {
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		zones: map[string][]dns.RR{
+			"catalog.invalid.": catalogZone("catalog.invalid.", "3", "example.com."),
+		},
+	})
+
+	defer cancel()
+
+	e := NewDNSSECExporter(2*time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	e.Catalogs = []Catalog{{Zone: "catalog.invalid", Server: addr}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	if _, err := e.catalogMembers(t.Context(), e.Catalogs[0]); err == nil || !strings.Contains(err.Error(), "schema version") {
+		t.Fatalf("expected an error about the schema version, got: %v", err)
+	}
+
+	if count := testutil.CollectAndCount(e, "dnssec_zone_transfer_success"); count != 0 {
+		t.Fatalf("expected no transfer_success series, got %d", count)
+	}
+
+}
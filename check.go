@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// checkConfig prints the checks that a validated exporter would run, for
+// -check-config. With lookup, it also looks up the address of every resolver
+// and zone server, so a typo in a host name fails the check instead of every
+// scrape.
+func checkConfig(ctx context.Context, w io.Writer, e *Exporter, lookup bool) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d resolvers:\n", len(e.resolvers))
+
+	for _, res := range e.resolvers {
+		fmt.Fprintf(&b, "  %s at %s over %s", res.Name, res.Address, res.Transport)
+
+		if len(res.Groups) > 0 {
+			fmt.Fprintf(&b, " in %s", strings.Join(res.Groups, ", "))
+		}
+
+		b.WriteString("\n")
+	}
+
+	checks := 0
+	for _, rec := range e.Records {
+		checks += len(e.resolversFor(rec))
+	}
+
+	fmt.Fprintf(&b, "%d records, %d checks per scrape:\n", len(e.Records), checks)
+
+	for _, rec := range e.Records {
+		names := make([]string, 0, len(e.resolvers))
+		for _, res := range e.resolversFor(rec) {
+			names = append(names, res.Name)
+		}
+
+		fmt.Fprintf(&b, "  %s on %s\n", rec, strings.Join(names, ", "))
+	}
+
+	fmt.Fprintf(&b, "%d zones:\n", len(e.Zones))
+
+	for _, zone := range e.Zones {
+		fmt.Fprintf(&b, "  %s from %s", zone.Zone, e.zoneServer(zone))
+
+		if zone.Key != "" {
+			fmt.Fprintf(&b, " with key %s", e.keys[dns.Fqdn(zone.Key)])
+		}
+
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "%d sources of more zones:\n", len(e.sources))
+
+	for _, source := range e.sources {
+		fmt.Fprintf(&b, "  %s %s, read every %s\n", source.kind, source.name, source.refresh)
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+
+	if !lookup {
+		return nil
+	}
+
+	var errs []error
+
+	for _, res := range e.resolvers {
+		if err := lookupAddress(ctx, res.Address); err != nil {
+			errs = append(errs, fmt.Errorf("resolver %s: %w", res.Name, err))
+		}
+	}
+
+	for _, zone := range e.Zones {
+		if err := lookupAddress(ctx, e.zoneServer(zone)); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %w", zone.Zone, err))
+		}
+	}
+
+	for _, source := range e.sources {
+		for _, address := range source.addresses {
+			if err := lookupAddress(ctx, address); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", source.kind, source.name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// lookupAddress looks up the host in a host:port address. An IP address needs
+// no lookup, and passes.
+func lookupAddress(ctx context.Context, address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("address %s: %w", address, err)
+	}
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return fmt.Errorf("look up %s: %w", host, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckConfigSummary(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, nil, nullLogger())
+	e.Resolvers = []Resolver{
+		{Name: "google", Address: "8.8.8.8", Groups: []string{"public"}},
+		{Name: "corp", Address: "10.0.0.53", Transport: "udp", Groups: []string{"internal"}},
+	}
+	e.Records = []Record{
+		{Zone: "example.org", Record: "@", Type: "SOA"},
+		{Zone: "corp.example.org", Record: "@", Type: "SOA", Groups: []string{"internal"}},
+	}
+	e.Zones = []Zone{{Zone: "example.com", Server: "192.0.2.1:53", Key: "k"}}
+	e.Keys = []Key{{Name: "k", Algorithm: "hmac-sha256", Secret: testSecret}}
+	e.Catalogs = []Catalog{{Zone: "catalog.example.com", Server: "192.0.2.1:53"}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	var out strings.Builder
+
+	// Every address is an IP address, so the lookup needs no network.
+	if err := checkConfig(t.Context(), &out, e, true); err != nil {
+		t.Fatalf("expected the check to pass, got: %v", err)
+	}
+
+	for _, want := range []string{
+		"google at 8.8.8.8:53 over tcp in public",
+		"corp at 10.0.0.53:53 over udp in internal",
+		"2 records, 3 checks per scrape",
+		"@ SOA in example.org on google, corp",
+		"@ SOA in corp.example.org on corp",
+		"example.com from 192.0.2.1:53 with key k. (hmac-sha256.)",
+		"catalog catalog.example.com, read every 5m0s",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("the summary does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	if strings.Contains(out.String(), testSecret) {
+		t.Fatalf("the summary contains the secret:\n%s", out.String())
+	}
+
+}
+
+func TestCheckConfigLookupFails(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	e.Zones = []Zone{{Zone: "example.com", Server: "ns1.example.invalid:53"}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	var out strings.Builder
+
+	if err := checkConfig(ctx, &out, e, false); err != nil {
+		t.Fatalf("expected the check without lookups to pass, got: %v", err)
+	}
+
+	err := checkConfig(ctx, &out, e, true)
+	if err == nil {
+		t.Fatal("expected the lookup of an .invalid host to fail")
+	}
+
+	if !strings.Contains(err.Error(), "zone example.com: look up ns1.example.invalid") {
+		t.Fatalf("expected an error that names the zone and the host, got: %v", err)
+	}
+
+}
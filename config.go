@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
@@ -17,11 +22,51 @@ import (
 // defaultDNSPort is applied to resolvers that are configured without a port.
 const defaultDNSPort = "53"
 
+// defaultWarnDays and defaultCriticalDays are the expiry thresholds for entries
+// and files that set none. 10 days is what the sample alert used before the
+// thresholds could be configured.
+const (
+	defaultWarnDays     = 20
+	defaultCriticalDays = 10
+)
+
+// maxEarliestSignatures bounds earliest_signatures, because every signature it
+// reports is a series of its own.
+const maxEarliestSignatures = 100
+
 // Record is one entry from the configuration file.
 type Record struct {
 	Zone   string
 	Record string
 	Type   string
+
+	// Records and Types list more than one record or type. loadExporter expands
+	// the entry into a Record for every pair of them.
+	Records []string
+	Types   []string
+
+	// Groups limits the check to the resolvers in these groups. Without it the
+	// record is checked on every resolver.
+	Groups []string
+
+	// Labels are added to every metric about the record.
+	Labels map[string]string
+
+	// WarnDays and CriticalDays override the expiry thresholds of the file.
+	WarnDays     int `toml:"warn_days" yaml:"warn_days"`
+	CriticalDays int `toml:"critical_days" yaml:"critical_days"`
+
+	// EachSignature reports every RRSIG that covers the record, rather than the
+	// earliest alone, so a key rollover shows which keys sign it.
+	EachSignature bool `toml:"each_signature" yaml:"each_signature"`
+
+	// CheckOrphans counts the RRSIGs that cover the record made by a key that
+	// the DNSKEY set does not have. It costs a DNSKEY query of the signer on
+	// every resolver in each check.
+	CheckOrphans bool `toml:"check_orphans" yaml:"check_orphans"`
+
+	// source is the configuration file the record was read from.
+	source string
 }
 
 // String returns the record in a form that identifies it in logs and errors.
@@ -35,6 +80,232 @@ type Zone struct {
 	Zone   string
 	Server string
 	Key    string
+
+	// Labels are added to every metric about the zone.
+	Labels map[string]string
+
+	WarnDays     int `toml:"warn_days" yaml:"warn_days"`
+	CriticalDays int `toml:"critical_days" yaml:"critical_days"`
+
+	// EarliestSignatures is the number of signatures, the earliest to expire
+	// first, that the exporter reports one by one. Zero reports none.
+	EarliestSignatures int `toml:"earliest_signatures" yaml:"earliest_signatures"`
+
+	// VerifyZONEMD checks the zone against its ZONEMD (RFC 8976). The exporter
+	// keeps the whole zone in memory during the transfer to do so.
+	VerifyZONEMD bool `toml:"verify_zonemd" yaml:"verify_zonemd"`
+
+	source string
+}
+
+// Resolver is one entry from the [[resolvers]] table. Name is the value of the
+// resolver label, and defaults to the address.
+type Resolver struct {
+	Name      string
+	Address   string
+	Transport string
+	Groups    []string
+
+	// MaxConcurrency limits the queries in flight to the resolver, and QPS the
+	// queries a second. Zero is no limit.
+	MaxConcurrency int     `toml:"max_concurrency"`
+	QPS            float64 `toml:"qps"`
+
+	source string
+}
+
+// Catalog is one entry from the [[catalogs]] table. The exporter transfers the
+// catalog zone (RFC 9432) and monitors every member zone as if it had a
+// [[zones]] entry with the server, key, labels and thresholds of the catalog.
+type Catalog struct {
+	Zone   string
+	Server string
+	Key    string
+
+	// Refresh is how often the exporter transfers the catalog again to find new
+	// member zones.
+	Refresh time.Duration
+
+	Labels       map[string]string
+	WarnDays     int `toml:"warn_days"`
+	CriticalDays int `toml:"critical_days"`
+
+	source string
+}
+
+// member returns the [[zones]] entry for a member zone of the catalog.
+func (c Catalog) member(name string) Zone {
+	return Zone{
+		Zone:         name,
+		Server:       c.Server,
+		Key:          c.Key,
+		Labels:       c.Labels,
+		WarnDays:     c.WarnDays,
+		CriticalDays: c.CriticalDays,
+		source:       c.source,
+	}
+}
+
+// PowerDNS is one entry from the [[powerdns]] table. The exporter reads the list
+// of zones from the HTTP API of a PowerDNS Authoritative Server, and monitors
+// every zone with DNSSEC as if it had a [[zones]] entry with the server, key,
+// labels and thresholds of this entry.
+type PowerDNS struct {
+	// URL is the base URL of the API, such as http://127.0.0.1:8081.
+	URL string
+
+	// ServerID is the server in the API whose zones are listed. It defaults to
+	// localhost, which is the only server a PowerDNS Authoritative Server has.
+	ServerID string `toml:"server_id"`
+
+	// APIKey authenticates to the API. APIKeyFile and APIKeyEnv read it from
+	// elsewhere, like the secret of a key.
+	APIKey     string `toml:"api_key"`
+	APIKeyFile string `toml:"api_key_file"`
+	APIKeyEnv  string `toml:"api_key_env"`
+
+	// Server and Key are the server to transfer the zones from and the key to
+	// sign the transfers with.
+	Server string
+	Key    string
+
+	// Refresh is how often the exporter reads the list of zones again.
+	Refresh time.Duration
+
+	Labels       map[string]string
+	WarnDays     int `toml:"warn_days"`
+	CriticalDays int `toml:"critical_days"`
+
+	source string
+}
+
+// LogValue keeps the API key out of the logs, like the secret of a Key.
+func (p PowerDNS) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("url", p.URL),
+		slog.String("server_id", p.ServerID),
+	)
+}
+
+// String keeps the API key out of error messages.
+func (p PowerDNS) String() string {
+	return p.URL
+}
+
+// zone returns the [[zones]] entry for a zone that the API lists.
+func (p PowerDNS) zone(name string) Zone {
+	return Zone{
+		Zone:         name,
+		Server:       p.Server,
+		Key:          p.Key,
+		Labels:       p.Labels,
+		WarnDays:     p.WarnDays,
+		CriticalDays: p.CriticalDays,
+		source:       p.source,
+	}
+}
+
+// ServerConfig is one entry from the [[server_configs]] table. The exporter
+// reads the zones from the configuration file of a BIND or Knot server, and
+// monitors every zone as if it had a [[zones]] entry with the server, key,
+// labels and thresholds of this entry.
+type ServerConfig struct {
+	// NamedConf and KnotConf are the path of a named.conf or a knot.conf. An
+	// entry sets one of them.
+	NamedConf string `toml:"named_conf"`
+	KnotConf  string `toml:"knot_conf"`
+
+	// Server and Key are the server to transfer the zones from and the key to
+	// sign the transfers with. Server defaults to the local server, because the
+	// file is read from the same host.
+	Server string
+	Key    string
+
+	// SignedOnly leaves out the zones that the server does not sign itself.
+	SignedOnly bool `toml:"signed_only"`
+
+	// Refresh is how often the exporter reads the file again.
+	Refresh time.Duration
+
+	Labels       map[string]string
+	WarnDays     int `toml:"warn_days"`
+	CriticalDays int `toml:"critical_days"`
+
+	source string
+}
+
+// path returns the configuration file of the server, relative to the file that
+// holds the entry.
+func (c ServerConfig) path() string {
+	if c.NamedConf != "" {
+		return relativeTo(c.source, c.NamedConf)
+	}
+
+	return relativeTo(c.source, c.KnotConf)
+}
+
+// zone returns the [[zones]] entry for a zone in the file.
+func (c ServerConfig) zone(name string) Zone {
+	server := c.Server
+	if server == "" {
+		server = localServer
+	}
+
+	return Zone{
+		Zone:         name,
+		Server:       server,
+		Key:          c.Key,
+		Labels:       c.Labels,
+		WarnDays:     c.WarnDays,
+		CriticalDays: c.CriticalDays,
+		source:       c.source,
+	}
+}
+
+// FileSD is one entry from the [[file_sd]] table. The exporter reads more
+// records and zones from the files it lists, and reads them again when they
+// change, without a reload.
+type FileSD struct {
+	// Files are the files to read, or glob patterns for them. A relative path
+	// is relative to the configuration file.
+	Files []string
+
+	// Refresh is how often the exporter reads the files again, in case a change
+	// was missed.
+	Refresh time.Duration
+
+	// Labels are added to every record and zone in the files that does not set
+	// the label itself.
+	Labels map[string]string
+
+	source string
+}
+
+// Module is one entry from the [[modules]] table. It sets how /probe checks a
+// target that the request names, like a module of the blackbox exporter.
+type Module struct {
+	Name string
+
+	// Prober is resolve, which queries a record on the resolvers, or transfer,
+	// which transfers the zone from a server.
+	Prober string
+
+	// Resolvers are the addresses of the resolvers to query, or of the server
+	// to transfer from, and Transport how to reach them. The resolver parameter
+	// of the request replaces them, unless the module has a key.
+	Resolvers []string
+	Transport string
+
+	// Key names the [[keys]] entry that signs a transfer. A module with a key
+	// transfers only from its own resolvers, so a request cannot have the
+	// exporter send signed requests to a server it picks.
+	Key string
+
+	// Timeout bounds each query and transfer of the probe. It defaults to
+	// -timeout.
+	Timeout time.Duration
+
+	source string
 }
 
 // Key is one entry from the [[keys]] table. It is a TSIG key that authenticates
@@ -43,6 +314,15 @@ type Key struct {
 	Name      string
 	Algorithm string
 	Secret    string
+
+	// SecretFile, SecretEnv and BindFile read the secret from elsewhere, so it
+	// does not have to be written in the configuration file. loadSecrets fills
+	// in Secret from them.
+	SecretFile string `toml:"secret_file"`
+	SecretEnv  string `toml:"secret_env"`
+	BindFile   string `toml:"bind_file"`
+
+	source string
 }
 
 // LogValue keeps the secret out of the logs. Without it, a log call that takes
@@ -63,9 +343,29 @@ func (k Key) String() string {
 // missing or duplicated metrics at scrape time.
 func (e *Exporter) Validate() error {
 	if len(e.Records) == 0 && len(e.Zones) == 0 {
-		return errors.New("nothing configured to check: add at least one [[records]] or [[zones]] section")
+		if len(e.Catalogs) == 0 && len(e.PowerDNS) == 0 && len(e.ServerConfigs) == 0 && len(e.FileSD) == 0 && len(e.Modules) == 0 {
+			return errors.New("nothing configured to check: add at least one [[records]], [[zones]], [[catalogs]], [[powerdns]], [[server_configs]], [[file_sd]] or [[modules]] section")
+		}
+	}
+
+	if err := e.validateThresholds(0, 0); err != nil {
+		return err
+	}
+
+	if e.CheckInterval < 0 {
+		return errors.New("check_interval must be positive")
 	}
 
+	if err := e.validateResolvers(); err != nil {
+		return err
+	}
+
+	if e.MaxConcurrency < 0 {
+		return errors.New("max_concurrency must be positive")
+	}
+
+	e.limits = newQueryLimits(e.MaxConcurrency, e.resolvers)
+
 	if err := e.validateKeys(); err != nil {
 		return err
 	}
@@ -74,42 +374,266 @@ func (e *Exporter) Validate() error {
 		return err
 	}
 
-	seen := make(map[Record]bool, len(e.Records))
+	if err := e.validateModules(); err != nil {
+		return err
+	}
+
+	e.sources = nil
+
+	if err := e.validateCatalogs(); err != nil {
+		return err
+	}
+
+	if err := e.validatePowerDNS(); err != nil {
+		return err
+	}
+
+	if err := e.validateServerConfigs(); err != nil {
+		return err
+	}
+
+	if err := e.validateFileSD(); err != nil {
+		return err
+	}
+
+	// seen maps each record to the file it was first read from.
+	seen := make(map[string]string, len(e.Records))
 
 	for _, rec := range e.Records {
-		if rec.Zone == "" {
-			return fmt.Errorf("record %q: zone is required", rec.Record)
+		if err := e.validateRecord(rec); err != nil {
+			return inFile(rec.source, err)
+		}
+
+		if first, ok := seen[rec.String()]; ok {
+			return duplicate("record "+rec.String(), first, rec.source)
+		}
+
+		seen[rec.String()] = rec.source
+	}
+
+	return e.validateLabels()
+}
+
+// validateRecord checks the settings of a record to check, whether it comes
+// from a [[records]] entry or a file_sd file.
+func (e *Exporter) validateRecord(rec Record) error {
+	if rec.Zone == "" {
+		return fmt.Errorf("record %q: zone is required", rec.Record)
+	}
+
+	if rec.Record == "" {
+		return fmt.Errorf("zone %q: record is required, use \"@\" for the zone apex", rec.Zone)
+	}
+
+	if _, ok := dns.StringToType[rec.Type]; !ok {
+		return fmt.Errorf("record %s in zone %s: unknown type %q, use a DNS type such as SOA, A or MX", rec.Record, rec.Zone, rec.Type)
+	}
+
+	if err := e.validateThresholds(rec.WarnDays, rec.CriticalDays); err != nil {
+		return fmt.Errorf("record %s: %w", rec, err)
+	}
+
+	for _, group := range rec.Groups {
+		if !e.hasGroup(group) {
+			return fmt.Errorf("record %s uses resolver group %q, which no [[resolvers]] section is in", rec, group)
+		}
+	}
+
+	return nil
+}
+
+// thresholds returns the warning and critical expiry thresholds of an entry.
+// An entry that sets none uses the thresholds of the file.
+func (e *Exporter) thresholds(warn, critical int) (int, int) {
+	if warn == 0 {
+		warn = e.WarnDays
+	}
+
+	if critical == 0 {
+		critical = e.CriticalDays
+	}
+
+	return warn, critical
+}
+
+// validateThresholds checks the thresholds an entry ends up with. A warning
+// that comes after the critical alert would never be seen.
+func (e *Exporter) validateThresholds(warn, critical int) error {
+	if warn < 0 || critical < 0 {
+		return errors.New("warn_days and critical_days must be positive")
+	}
+
+	warn, critical = e.thresholds(warn, critical)
+
+	if warn <= critical {
+		return fmt.Errorf("warn_days (%d) must be more than critical_days (%d)", warn, critical)
+	}
+
+	return nil
+}
+
+// labelName is the syntax Prometheus accepts for a label name.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateLabels checks the custom labels and rebuilds the metric descriptions
+// with them. Every metric from one description must have the same label names,
+// so each description carries every custom label that any entry sets.
+func (e *Exporter) validateLabels() error {
+	names := make(map[string]bool)
+
+	check := func(source, entry string, labels map[string]string) error {
+		for name := range labels {
+			if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+				return inFile(source, fmt.Errorf("%s has label %q, which is not a valid label name: use letters, digits and underscores, and do not start with __", entry, name))
+			}
+
+			if e.reservedLabels[name] {
+				return inFile(source, fmt.Errorf("%s has label %q, which the exporter sets itself: choose another name", entry, name))
+			}
+
+			names[name] = true
+		}
+
+		return nil
+	}
+
+	for _, rec := range e.Records {
+		if err := check(rec.source, "record "+rec.String(), rec.Labels); err != nil {
+			return err
+		}
+	}
+
+	for _, zone := range e.Zones {
+		if err := check(zone.source, "zone "+zone.Zone, zone.Labels); err != nil {
+			return err
 		}
+	}
 
-		if rec.Record == "" {
-			return fmt.Errorf("zone %q: record is required, use \"@\" for the zone apex", rec.Zone)
+	for _, catalog := range e.Catalogs {
+		if err := check(catalog.source, "catalog "+catalog.Zone, catalog.Labels); err != nil {
+			return err
 		}
+	}
 
-		if _, ok := dns.StringToType[rec.Type]; !ok {
-			return fmt.Errorf("record %s in zone %s: unknown type %q, use a DNS type such as SOA, A or MX", rec.Record, rec.Zone, rec.Type)
+	for _, p := range e.PowerDNS {
+		if err := check(p.source, "powerdns "+p.URL, p.Labels); err != nil {
+			return err
 		}
+	}
 
-		if seen[rec] {
-			return fmt.Errorf("record %s is configured more than once, remove the duplicate", rec)
+	for _, c := range e.ServerConfigs {
+		if err := check(c.source, "server config "+c.path(), c.Labels); err != nil {
+			return err
 		}
+	}
 
-		seen[rec] = true
+	for _, sd := range e.FileSD {
+		if err := check(sd.source, "file_sd "+strings.Join(sd.Files, ", "), sd.Labels); err != nil {
+			return err
+		}
 	}
 
+	labels := slices.Sorted(maps.Keys(names))
+	e.newDescs(labels)
+
 	return nil
 }
 
+// transports are the values a [[resolvers]] entry accepts for transport, and
+// the port each uses when the address has none.
+var transports = map[string]string{
+	"udp":     defaultDNSPort,
+	"tcp":     defaultDNSPort,
+	"tcp-tls": "853",
+}
+
+// validateResolvers checks the [[resolvers]] table. The table replaces the
+// resolvers given with -resolvers, so a configuration file that has one does
+// not depend on the command line.
+func (e *Exporter) validateResolvers() error {
+	if len(e.Resolvers) == 0 {
+		if len(e.resolvers) == 0 {
+			return errors.New("no resolvers configured: add a [[resolvers]] section or pass -resolvers")
+		}
+
+		return nil
+	}
+
+	resolvers := make([]Resolver, 0, len(e.Resolvers))
+	seen := make(map[string]string, len(e.Resolvers))
+
+	// The limits are by address, so the entries with one address share them.
+	byAddress := make(map[string]Resolver, len(e.Resolvers))
+
+	for _, res := range e.Resolvers {
+		if res.Address == "" {
+			return inFile(res.source, fmt.Errorf("resolver %q has no address: give every [[resolvers]] entry an address", res.Name))
+		}
+
+		if res.Transport == "" {
+			res.Transport = "tcp"
+		}
+
+		port, ok := transports[res.Transport]
+		if !ok {
+			return inFile(res.source, fmt.Errorf("resolver %s has unknown transport %q, use udp, tcp or tcp-tls", res.Address, res.Transport))
+		}
+
+		if _, _, err := net.SplitHostPort(res.Address); err != nil {
+			res.Address = net.JoinHostPort(res.Address, port)
+		}
+
+		if res.Name == "" {
+			res.Name = res.Address
+		}
+
+		if res.MaxConcurrency < 0 || res.QPS < 0 {
+			return inFile(res.source, fmt.Errorf("resolver %s: max_concurrency and qps must be positive", res.Name))
+		}
+
+		if first, ok := seen[res.Name]; ok {
+			return duplicate("resolver "+res.Name, first, res.source)
+		}
+
+		seen[res.Name] = res.source
+
+		if other, ok := byAddress[res.Address]; ok && (other.MaxConcurrency != res.MaxConcurrency || other.QPS != res.QPS) {
+			return inFile(res.source, fmt.Errorf("resolvers %s and %s have the address %s but other limits: give them the same max_concurrency and qps",
+				other.Name, res.Name, res.Address))
+		}
+
+		byAddress[res.Address] = res
+
+		resolvers = append(resolvers, res)
+	}
+
+	e.resolvers = resolvers
+
+	return nil
+}
+
+// hasGroup reports whether any resolver is in group.
+func (e *Exporter) hasGroup(group string) bool {
+	for _, res := range e.resolvers {
+		if slices.Contains(res.Groups, group) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // validateKeys checks the [[keys]] table and indexes it by key name.
 func (e *Exporter) validateKeys() error {
 	e.keys = make(map[string]Key, len(e.Keys))
 
 	for _, key := range e.Keys {
 		if key.Name == "" {
-			return errors.New("a key has no name: give every [[keys]] entry a name")
+			return inFile(key.source, errors.New("a key has no name: give every [[keys]] entry a name"))
 		}
 
 		if key.Secret == "" {
-			return fmt.Errorf("key %s has no secret: give it the base64 secret from tsig-keygen", key.Name)
+			return inFile(key.source, fmt.Errorf("key %s has no secret: give it the base64 secret from tsig-keygen, or set secret_file, secret_env or bind_file", key.Name))
 		}
 
 		// miekg/dns matches the key name and algorithm in canonical form, so a
@@ -118,15 +642,15 @@ func (e *Exporter) validateKeys() error {
 		algorithm := dns.Fqdn(key.Algorithm)
 
 		if !tsigAlgorithms[algorithm] {
-			return fmt.Errorf("key %s has unknown algorithm %q, use one of %s",
-				key.Name, key.Algorithm, strings.Join(tsigAlgorithmNames(), ", "))
+			return inFile(key.source, fmt.Errorf("key %s has unknown algorithm %q, use one of %s",
+				key.Name, key.Algorithm, strings.Join(tsigAlgorithmNames(), ", ")))
 		}
 
-		if _, ok := e.keys[name]; ok {
-			return fmt.Errorf("key %s is configured more than once, remove the duplicate", key.Name)
+		if first, ok := e.keys[name]; ok {
+			return duplicate("key "+key.Name, first.source, key.source)
 		}
 
-		e.keys[name] = Key{Name: name, Algorithm: algorithm, Secret: key.Secret}
+		e.keys[name] = Key{Name: name, Algorithm: algorithm, Secret: key.Secret, source: key.source}
 	}
 
 	return nil
@@ -134,37 +658,357 @@ func (e *Exporter) validateKeys() error {
 
 // validateZones checks the [[zones]] table against the configured keys.
 func (e *Exporter) validateZones() error {
-	seen := make(map[string]bool, len(e.Zones))
+	seen := make(map[string]string, len(e.Zones))
 
 	for _, zone := range e.Zones {
 		if zone.Zone == "" {
-			return errors.New("a zone has no name: give every [[zones]] entry a zone")
+			return inFile(zone.source, errors.New("a zone has no name: give every [[zones]] entry a zone"))
 		}
 
-		if zone.Key != "" {
-			if _, ok := e.keys[dns.Fqdn(zone.Key)]; !ok {
-				return fmt.Errorf("zone %s uses key %q, which no [[keys]] section defines", zone.Zone, zone.Key)
-			}
+		if err := e.validateZone(zone); err != nil {
+			return inFile(zone.source, err)
+		}
+
+		name := dns.Fqdn(zone.Zone)
+		if first, ok := seen[name]; ok {
+			return duplicate("zone "+zone.Zone, first, zone.source)
+		}
+
+		seen[name] = zone.source
+	}
+
+	return nil
+}
+
+// validateZone checks the settings that every zone to transfer has, whether it
+// comes from a [[zones]] entry or another table.
+func (e *Exporter) validateZone(zone Zone) error {
+	if err := e.validateThresholds(zone.WarnDays, zone.CriticalDays); err != nil {
+		return fmt.Errorf("zone %s: %w", zone.Zone, err)
+	}
+
+	if zone.EarliestSignatures < 0 || zone.EarliestSignatures > maxEarliestSignatures {
+		return fmt.Errorf("zone %s: earliest_signatures must be between 0 and %d", zone.Zone, maxEarliestSignatures)
+	}
+
+	if zone.Key != "" {
+		if _, ok := e.keys[dns.Fqdn(zone.Key)]; !ok {
+			return fmt.Errorf("zone %s uses key %q, which no [[keys]] section defines", zone.Zone, zone.Key)
+		}
+	}
+
+	if e.zoneServer(zone) == "" {
+		return fmt.Errorf("zone %s has no server, and every resolver uses tcp-tls, which a zone transfer cannot: set server", zone.Zone)
+	}
+
+	if zone.Server != "" {
+		if _, _, err := net.SplitHostPort(zone.Server); err != nil {
+			return fmt.Errorf("zone %s: server %q needs a port, for example %q",
+				zone.Zone, zone.Server, net.JoinHostPort(zone.Server, defaultDNSPort))
+		}
+	}
+
+	return nil
+}
+
+// probers are the values a [[modules]] entry accepts for prober.
+var probers = map[string]bool{
+	"resolve":  true,
+	"transfer": true,
+}
+
+// validateModules checks the [[modules]] table and indexes it by name. A
+// module that sets no resolvers probes with the resolvers of the exporter.
+func (e *Exporter) validateModules() error {
+	e.modules = make(map[string]Module, len(e.Modules))
+
+	for _, m := range e.Modules {
+		if m.Name == "" {
+			return inFile(m.source, errors.New("a module has no name: give every [[modules]] entry a name"))
+		}
+
+		if _, ok := e.modules[m.Name]; ok {
+			return duplicate("module "+m.Name, e.modules[m.Name].source, m.source)
+		}
+
+		if m.Prober == "" {
+			m.Prober = "resolve"
+		}
+
+		if !probers[m.Prober] {
+			return inFile(m.source, fmt.Errorf("module %s has unknown prober %q, use resolve or transfer", m.Name, m.Prober))
+		}
+
+		if m.Transport == "" {
+			m.Transport = "tcp"
+		}
+
+		if _, ok := transports[m.Transport]; !ok {
+			return inFile(m.source, fmt.Errorf("module %s has unknown transport %q, use udp, tcp or tcp-tls", m.Name, m.Transport))
 		}
 
-		if zone.Server != "" {
-			if _, _, err := net.SplitHostPort(zone.Server); err != nil {
-				return fmt.Errorf("zone %s: server %q needs a port, for example %q",
-					zone.Zone, zone.Server, net.JoinHostPort(zone.Server, defaultDNSPort))
+		if m.Key != "" {
+			if _, ok := e.keys[dns.Fqdn(m.Key)]; !ok {
+				return inFile(m.source, fmt.Errorf("module %s uses key %q, which no [[keys]] section defines", m.Name, m.Key))
+			}
+
+			if len(m.Resolvers) == 0 {
+				return inFile(m.source, fmt.Errorf("module %s uses a key, so it must list the resolvers it transfers from", m.Name))
 			}
 		}
 
-		name := dns.Fqdn(zone.Zone)
-		if seen[name] {
-			return fmt.Errorf("zone %s is configured more than once, remove the duplicate", zone.Zone)
+		if m.Timeout < 0 {
+			return inFile(m.source, fmt.Errorf("module %s: timeout must be positive", m.Name))
 		}
 
-		seen[name] = true
+		e.modules[m.Name] = m
 	}
 
 	return nil
 }
 
+// validateCatalogs checks the [[catalogs]] table, and sets up a source of zones
+// for every catalog.
+func (e *Exporter) validateCatalogs() error {
+	seen := make(map[string]string, len(e.Catalogs))
+
+	for _, catalog := range e.Catalogs {
+		if catalog.Zone == "" {
+			return inFile(catalog.source, errors.New("a catalog has no zone: give every [[catalogs]] entry a zone"))
+		}
+
+		if err := e.validateZone(catalog.member(catalog.Zone)); err != nil {
+			return inFile(catalog.source, err)
+		}
+
+		if catalog.Refresh < 0 {
+			return inFile(catalog.source, fmt.Errorf("catalog %s: refresh must be positive", catalog.Zone))
+		}
+
+		name := dns.Fqdn(catalog.Zone)
+		if first, ok := seen[name]; ok {
+			return duplicate("catalog "+catalog.Zone, first, catalog.source)
+		}
+
+		seen[name] = catalog.source
+
+		refresh := catalog.Refresh
+		if refresh == 0 {
+			refresh = defaultRefresh
+		}
+
+		e.sources = append(e.sources, &zoneSource{
+			kind:      "catalog",
+			name:      catalog.Zone,
+			refresh:   refresh,
+			labels:    catalog.Labels,
+			addresses: []string{e.zoneServer(catalog.member(catalog.Zone))},
+			fetch: func(ctx context.Context) ([]Zone, error) {
+				return e.catalogMembers(ctx, catalog)
+			},
+		})
+	}
+
+	return nil
+}
+
+// validatePowerDNS checks the [[powerdns]] table, and sets up a source of zones
+// for every entry.
+func (e *Exporter) validatePowerDNS() error {
+	seen := make(map[string]string, len(e.PowerDNS))
+
+	for _, p := range e.PowerDNS {
+		if p.URL == "" {
+			return inFile(p.source, errors.New("a [[powerdns]] entry has no url: give it the base URL of the API"))
+		}
+
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return inFile(p.source, fmt.Errorf("powerdns %s: url must be an http or https URL, such as http://127.0.0.1:8081", p.URL))
+		}
+
+		if p.APIKey == "" {
+			return inFile(p.source, fmt.Errorf("powerdns %s has no API key: set api_key, api_key_file or api_key_env", p.URL))
+		}
+
+		if err := e.validateZone(p.zone(p.URL)); err != nil {
+			return inFile(p.source, err)
+		}
+
+		if p.Refresh < 0 {
+			return inFile(p.source, fmt.Errorf("powerdns %s: refresh must be positive", p.URL))
+		}
+
+		if p.ServerID == "" {
+			p.ServerID = "localhost"
+		}
+
+		// The API server is unique, and names the source in the metrics.
+		name := u.JoinPath("api/v1/servers", p.ServerID).String()
+		if first, ok := seen[name]; ok {
+			return duplicate("powerdns "+name, first, p.source)
+		}
+
+		seen[name] = p.source
+
+		refresh := p.Refresh
+		if refresh == 0 {
+			refresh = defaultRefresh
+		}
+
+		e.sources = append(e.sources, &zoneSource{
+			kind:      "powerdns",
+			name:      name,
+			refresh:   refresh,
+			labels:    p.Labels,
+			addresses: []string{hostPort(u), e.zoneServer(p.zone(p.URL))},
+			fetch: func(ctx context.Context) ([]Zone, error) {
+				return e.powerDNSZones(ctx, p, name+"/zones")
+			},
+		})
+	}
+
+	return nil
+}
+
+// validateServerConfigs checks the [[server_configs]] table, and sets up a
+// source of zones for every entry.
+func (e *Exporter) validateServerConfigs() error {
+	seen := make(map[string]string, len(e.ServerConfigs))
+
+	for _, c := range e.ServerConfigs {
+		if (c.NamedConf == "") == (c.KnotConf == "") {
+			return inFile(c.source, errors.New("a [[server_configs]] entry must set one of named_conf and knot_conf"))
+		}
+
+		kind, read := "bind", namedConfZones
+		if c.KnotConf != "" {
+			kind, read = "knot", knotConfZones
+		}
+
+		path := c.path()
+
+		if err := e.validateZone(c.zone(path)); err != nil {
+			return inFile(c.source, err)
+		}
+
+		if c.Refresh < 0 {
+			return inFile(c.source, fmt.Errorf("server config %s: refresh must be positive", path))
+		}
+
+		if first, ok := seen[path]; ok {
+			return duplicate("server config "+path, first, c.source)
+		}
+
+		seen[path] = c.source
+
+		refresh := c.Refresh
+		if refresh == 0 {
+			refresh = defaultRefresh
+		}
+
+		e.sources = append(e.sources, &zoneSource{
+			kind:      kind,
+			name:      path,
+			refresh:   refresh,
+			labels:    c.Labels,
+			addresses: []string{e.zoneServer(c.zone(path))},
+			fetch: func(context.Context) ([]Zone, error) {
+				names, err := read(path, c.SignedOnly)
+				if err != nil {
+					return nil, err
+				}
+
+				zones := make([]Zone, 0, len(names))
+				for _, name := range names {
+					zones = append(zones, c.zone(name))
+				}
+
+				return zones, nil
+			},
+		})
+	}
+
+	return nil
+}
+
+// validateFileSD checks the [[file_sd]] table, and sets up a source of records
+// and zones for every entry. The files are read at the first scrape, so a file
+// that is not there yet does not stop the exporter.
+func (e *Exporter) validateFileSD() error {
+	seen := make(map[string]string, len(e.FileSD))
+
+	e.fileSD = nil
+
+	for _, entry := range e.FileSD {
+		if len(entry.Files) == 0 {
+			return inFile(entry.source, errors.New("a [[file_sd]] entry has no files: list the files to read"))
+		}
+
+		if entry.Refresh < 0 {
+			return inFile(entry.source, fmt.Errorf("file_sd %s: refresh must be positive", strings.Join(entry.Files, ", ")))
+		}
+
+		patterns := make([]string, 0, len(entry.Files))
+		for _, file := range entry.Files {
+			patterns = append(patterns, relativeTo(entry.source, file))
+		}
+
+		name := strings.Join(patterns, ",")
+		if first, ok := seen[name]; ok {
+			return duplicate("file_sd "+name, first, entry.source)
+		}
+
+		seen[name] = entry.source
+
+		refresh := entry.Refresh
+		if refresh == 0 {
+			refresh = defaultRefresh
+		}
+
+		sd := &fileSD{
+			patterns: patterns,
+			labels:   entry.Labels,
+			files:    make(map[string]fileTargets),
+		}
+
+		sd.source = &zoneSource{
+			kind:    "file",
+			name:    name,
+			refresh: refresh,
+			labels:  entry.Labels,
+			fetch: func(context.Context) ([]Zone, error) {
+				return e.readFileSD(sd)
+			},
+		}
+
+		e.fileSD = append(e.fileSD, sd)
+		e.sources = append(e.sources, sd.source)
+	}
+
+	return nil
+}
+
+// inFile names the file that an entry was read from in err, so the error points
+// at the file to fix when the configuration includes other files.
+func inFile(source string, err error) error {
+	if source == "" {
+		return err
+	}
+
+	return fmt.Errorf("%s: %w", source, err)
+}
+
+// duplicate reports an entry that is configured twice, and names both files it
+// was read from.
+func duplicate(entry, first, second string) error {
+	if first == "" && second == "" {
+		return fmt.Errorf("%s is configured more than once, remove the duplicate", entry)
+	}
+
+	return fmt.Errorf("%s is configured more than once, in %s and in %s, remove the duplicate", entry, first, second)
+}
+
 // tsigAlgorithms are the TSIG algorithms that miekg/dns still supports. HMAC-MD5
 // is left out on purpose, because it is broken and the library rejects it.
 var tsigAlgorithms = map[string]bool{
@@ -213,16 +1057,62 @@ func parseResolvers(list string) ([]string, error) {
 
 // config is the schema of the configuration file.
 type config struct {
-	Records []Record
-	Zones   []Zone
-	Keys    []Key
+	// Include lists more configuration files, or glob patterns for them. A
+	// relative path is relative to the file that includes it.
+	Include []string
+
+	// WarnDays and CriticalDays are the expiry thresholds of the entries that
+	// set none.
+	WarnDays     int `toml:"warn_days"`
+	CriticalDays int `toml:"critical_days"`
+
+	// CheckInterval runs the checks in the background instead of at every
+	// scrape.
+	CheckInterval time.Duration `toml:"check_interval"`
+
+	// MaxConcurrency limits the queries and zone transfers in flight.
+	MaxConcurrency int `toml:"max_concurrency"`
+
+	Records   []Record
+	Zones     []Zone
+	Keys      []Key
+	Resolvers []Resolver
+	Catalogs  []Catalog
+	PowerDNS  []PowerDNS
+
+	ServerConfigs []ServerConfig `toml:"server_configs"`
+	FileSD        []FileSD       `toml:"file_sd"`
+
+	Modules []Module
+
+	// settings are the top-level settings that the file sets, which only the
+	// main configuration file may set.
+	settings []string
 }
 
-// loadExporter reads the configuration file and returns a validated exporter.
-func loadExporter(path string, timeout time.Duration, resolvers []string, logger *slog.Logger) (*Exporter, error) {
+// topLevelSettings are the keys of the settings that apply to the whole
+// configuration rather than to an entry.
+var topLevelSettings = []string{"warn_days", "critical_days", "check_interval", "max_concurrency"}
+
+// readConfig reads the configuration file at path and the files it includes,
+// and merges them into one configuration. Every entry remembers the file it was
+// read from. seen holds the files that were already read, so a file that
+// includes itself is an error rather than a loop.
+func readConfig(path string, seen map[string]bool) (config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return config{}, fmt.Errorf("configuration file %s: %w", path, err)
+	}
+
+	if seen[abs] {
+		return config{}, fmt.Errorf("configuration file %s is included more than once", path)
+	}
+
+	seen[abs] = true
+
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("open configuration file %s: %w", path, err)
+		return config{}, fmt.Errorf("open configuration file %s: %w", path, err)
 	}
 	// The file is only read, so a failure to close it cannot lose data.
 	defer func() { _ = f.Close() }()
@@ -231,7 +1121,7 @@ func loadExporter(path string, timeout time.Duration, resolvers []string, logger
 
 	md, err := toml.NewDecoder(f).Decode(&cfg)
 	if err != nil {
-		return nil, fmt.Errorf("parse configuration file %s: %w", path, err)
+		return config{}, fmt.Errorf("parse configuration file %s: %w", path, err)
 	}
 
 	// A misspelled key must stop the exporter. Left unreported, it reads as a
@@ -242,13 +1132,177 @@ func loadExporter(path string, timeout time.Duration, resolvers []string, logger
 			keys = append(keys, key.String())
 		}
 
-		return nil, fmt.Errorf("configuration file %s has unknown keys: %s", path, strings.Join(keys, ", "))
+		return config{}, fmt.Errorf("configuration file %s has unknown keys: %s", path, strings.Join(keys, ", "))
+	}
+
+	for _, key := range topLevelSettings {
+		if md.IsDefined(key) {
+			cfg.settings = append(cfg.settings, key)
+		}
+	}
+
+	for i := range cfg.Records {
+		cfg.Records[i].source = path
+	}
+
+	for i := range cfg.Zones {
+		cfg.Zones[i].source = path
+	}
+
+	for i := range cfg.Keys {
+		cfg.Keys[i].source = path
+	}
+
+	for i := range cfg.Resolvers {
+		cfg.Resolvers[i].source = path
+	}
+
+	for i := range cfg.Catalogs {
+		cfg.Catalogs[i].source = path
+	}
+
+	for i := range cfg.PowerDNS {
+		cfg.PowerDNS[i].source = path
+	}
+
+	for i := range cfg.ServerConfigs {
+		cfg.ServerConfigs[i].source = path
+	}
+
+	for i := range cfg.FileSD {
+		cfg.FileSD[i].source = path
+	}
+
+	for i := range cfg.Modules {
+		cfg.Modules[i].source = path
+	}
+
+	for _, pattern := range cfg.Include {
+		pattern = relativeTo(path, pattern)
+
+		files, err := includedFiles(pattern)
+		if err != nil {
+			return config{}, fmt.Errorf("configuration file %s: include %q: %w", path, pattern, err)
+		}
+
+		for _, file := range files {
+			included, err := readConfig(file, seen)
+			if err != nil {
+				return config{}, err
+			}
+
+			// A setting in an included file would be dropped, or conflict
+			// with the main file, so it is an error.
+			if len(included.settings) > 0 {
+				return config{}, fmt.Errorf("configuration file %s sets %s, which only the main configuration file can set",
+					file, strings.Join(included.settings, ", "))
+			}
+
+			cfg.Records = append(cfg.Records, included.Records...)
+			cfg.Zones = append(cfg.Zones, included.Zones...)
+			cfg.Keys = append(cfg.Keys, included.Keys...)
+			cfg.Resolvers = append(cfg.Resolvers, included.Resolvers...)
+			cfg.Catalogs = append(cfg.Catalogs, included.Catalogs...)
+			cfg.PowerDNS = append(cfg.PowerDNS, included.PowerDNS...)
+			cfg.ServerConfigs = append(cfg.ServerConfigs, included.ServerConfigs...)
+			cfg.FileSD = append(cfg.FileSD, included.FileSD...)
+			cfg.Modules = append(cfg.Modules, included.Modules...)
+		}
+	}
+
+	return cfg, nil
+}
+
+// expandRecords turns every entry that lists records or types into one Record
+// per record and type, so Validate finds a duplicate pair in any two entries.
+func expandRecords(entries []Record) ([]Record, error) {
+	records := make([]Record, 0, len(entries))
+
+	for _, entry := range entries {
+		names := entry.Records
+		if len(names) == 0 {
+			names = []string{entry.Record}
+		} else if entry.Record != "" {
+			return nil, inFile(entry.source, fmt.Errorf("zone %q: set record or records, not both", entry.Zone))
+		}
+
+		types := entry.Types
+		if len(types) == 0 {
+			types = []string{entry.Type}
+		} else if entry.Type != "" {
+			return nil, inFile(entry.source, fmt.Errorf("zone %q: set type or types, not both", entry.Zone))
+		}
+
+		for _, name := range names {
+			for _, recordType := range types {
+				rec := entry
+				rec.Record = name
+				rec.Type = recordType
+				rec.Records = nil
+				rec.Types = nil
+
+				records = append(records, rec)
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// includedFiles expands an include pattern. A glob that matches nothing is not
+// an error, so an empty conf.d directory is valid. A plain path must exist, so
+// it is returned as it is and fails when it is opened.
+func includedFiles(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	return filepath.Glob(pattern)
+}
+
+// loadExporter reads the configuration file and returns a validated exporter.
+func loadExporter(path string, timeout time.Duration, resolvers []string, logger *slog.Logger) (*Exporter, error) {
+	cfg, err := readConfig(path, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := expandRecords(cfg.Records)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	keys, err := loadSecrets(cfg.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	powerDNS, err := loadAPIKeys(cfg.PowerDNS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
 	}
 
 	exporter := NewDNSSECExporter(timeout, resolvers, logger)
-	exporter.Records = cfg.Records
+	exporter.Records = records
 	exporter.Zones = cfg.Zones
-	exporter.Keys = cfg.Keys
+	exporter.Keys = keys
+	exporter.Resolvers = cfg.Resolvers
+	exporter.Catalogs = cfg.Catalogs
+	exporter.PowerDNS = powerDNS
+	exporter.ServerConfigs = cfg.ServerConfigs
+	exporter.FileSD = cfg.FileSD
+	exporter.Modules = cfg.Modules
+
+	if cfg.WarnDays != 0 {
+		exporter.WarnDays = cfg.WarnDays
+	}
+
+	if cfg.CriticalDays != 0 {
+		exporter.CriticalDays = cfg.CriticalDays
+	}
+
+	exporter.CheckInterval = cfg.CheckInterval
+	exporter.MaxConcurrency = cfg.MaxConcurrency
 
 	if err := exporter.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
@@ -5,10 +5,13 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"slices"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestValidateKeysAndZones(t *testing.T) {
@@ -53,6 +56,15 @@ func TestValidateKeysAndZones(t *testing.T) {
 			zones:   []Zone{{Zone: "example.com", Server: "127.0.0.1"}},
 			wantErr: "needs a port",
 		},
+		{
+			name:  "zone with earliest signatures",
+			zones: []Zone{{Zone: "example.com", EarliestSignatures: 10}},
+		},
+		{
+			name:    "too many earliest signatures",
+			zones:   []Zone{{Zone: "example.com", EarliestSignatures: 1000}},
+			wantErr: "earliest_signatures must be between 0 and 100",
+		},
 		{
 			name:    "key without a secret",
 			zones:   []Zone{{Zone: "example.com"}},
@@ -215,6 +227,53 @@ func TestLoadExporter(t *testing.T) {
 `,
 			wantErr: "unknown keys",
 		},
+		{
+			name: "lists of records and types",
+			data: `
+[[records]]
+  zone = "example.org"
+  records = ["@", "www"]
+  types = ["A", "AAAA"]
+
+[[records]]
+  zone = "example.org"
+  record = "@"
+  types = ["SOA"]
+`,
+			wantRecords: []Record{
+				{Zone: "example.org", Record: "@", Type: "A"},
+				{Zone: "example.org", Record: "@", Type: "AAAA"},
+				{Zone: "example.org", Record: "www", Type: "A"},
+				{Zone: "example.org", Record: "www", Type: "AAAA"},
+				{Zone: "example.org", Record: "@", Type: "SOA"},
+			},
+		},
+		{
+			name: "record and records",
+			data: `
+[[records]]
+  zone = "example.org"
+  record = "@"
+  records = ["www"]
+  type = "A"
+`,
+			wantErr: "set record or records, not both",
+		},
+		{
+			name: "duplicate after expansion",
+			data: `
+[[records]]
+  zone = "example.org"
+  records = ["@", "www"]
+  types = ["A", "MX"]
+
+[[records]]
+  zone = "example.org"
+  record = "www"
+  type = "MX"
+`,
+			wantErr: "record www MX in example.org is configured more than once",
+		},
 		{
 			name:    "syntax error",
 			data:    "[[records]\n",
@@ -263,7 +322,11 @@ func TestLoadExporter(t *testing.T) {
 				t.Fatalf("expected no error, got: %v", err)
 			}
 
-			if !slices.Equal(e.Records, tt.wantRecords) {
+			for i := range tt.wantRecords {
+				tt.wantRecords[i].source = path
+			}
+
+			if !reflect.DeepEqual(e.Records, tt.wantRecords) {
 				t.Fatalf("records = %v, want %v", e.Records, tt.wantRecords)
 			}
 		})
@@ -304,8 +367,8 @@ func TestLoadExporterReadsZonesAndKeys(t *testing.T) {
 		t.Fatalf("expected no error, got: %v", err)
 	}
 
-	wantZones := []Zone{{Zone: "example.com", Server: "127.0.0.1:5353", Key: "mysecretkey."}}
-	if !slices.Equal(e.Zones, wantZones) {
+	wantZones := []Zone{{Zone: "example.com", Server: "127.0.0.1:5353", Key: "mysecretkey.", source: path}}
+	if !reflect.DeepEqual(e.Zones, wantZones) {
 		t.Fatalf("zones = %v, want %v", e.Zones, wantZones)
 	}
 
@@ -372,3 +435,436 @@ func TestValidate(t *testing.T) {
 	}
 
 }
+
+// A transfer is plain TCP, so it must not default to a resolver on the port of
+// DNS over TLS.
+func TestZoneServerSkipsTLS(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, nil, nullLogger())
+	e.Resolvers = []Resolver{
+		{Name: "quad9", Address: "9.9.9.9", Transport: "tcp-tls"},
+		{Name: "internal", Address: "192.0.2.1"},
+	}
+	e.Zones = []Zone{{Zone: "example.com"}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	if got := e.zoneServer(e.Zones[0]); got != "192.0.2.1:53" {
+		t.Fatalf("zoneServer = %q, want the resolver without tcp-tls", got)
+	}
+
+	e.Resolvers = e.Resolvers[:1]
+
+	if err := e.Validate(); err == nil || !strings.Contains(err.Error(), "every resolver uses tcp-tls") {
+		t.Fatalf("expected an error about the transfer server, got: %v", err)
+	}
+
+	e.Zones[0].Server = "192.0.2.2:53"
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a zone with a server to be valid, got: %v", err)
+	}
+
+}
+
+func TestValidateResolvers(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		resolvers []Resolver
+		groups    []string
+		want      []Resolver
+		wantErr   string
+	}{
+		{
+			name:      "defaults",
+			resolvers: []Resolver{{Address: "192.0.2.1"}},
+			want:      []Resolver{{Name: "192.0.2.1:53", Address: "192.0.2.1:53", Transport: "tcp"}},
+		},
+		{
+			name:      "tls uses port 853",
+			resolvers: []Resolver{{Name: "quad9", Address: "9.9.9.9", Transport: "tcp-tls"}},
+			want:      []Resolver{{Name: "quad9", Address: "9.9.9.9:853", Transport: "tcp-tls"}},
+		},
+		{
+			name:      "record uses a group",
+			resolvers: []Resolver{{Name: "internal", Address: "192.0.2.1:53", Groups: []string{"internal"}}},
+			groups:    []string{"internal"},
+			want:      []Resolver{{Name: "internal", Address: "192.0.2.1:53", Transport: "tcp", Groups: []string{"internal"}}},
+		},
+		{
+			name:      "record uses a group that no resolver is in",
+			resolvers: []Resolver{{Name: "google", Address: "8.8.8.8:53", Groups: []string{"public"}}},
+			groups:    []string{"internal"},
+			wantErr:   "which no [[resolvers]] section is in",
+		},
+		{
+			name:      "resolver without an address",
+			resolvers: []Resolver{{Name: "google"}},
+			wantErr:   "has no address",
+		},
+		{
+			name:      "unknown transport",
+			resolvers: []Resolver{{Address: "8.8.8.8:53", Transport: "quic"}},
+			wantErr:   "unknown transport",
+		},
+		{
+			name:      "duplicate name",
+			resolvers: []Resolver{{Name: "a", Address: "8.8.8.8"}, {Name: "a", Address: "1.1.1.1"}},
+			wantErr:   "configured more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+			e.Resolvers = tt.resolvers
+			e.Records = []Record{{Zone: "example.org", Record: "@", Type: "SOA", Groups: tt.groups}}
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if !reflect.DeepEqual(e.resolvers, tt.want) {
+				t.Fatalf("resolvers = %v, want %v", e.resolvers, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestLoadExporterIncludes(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		main        string
+		files       map[string]string
+		wantRecords int
+		wantErr     []string
+	}{
+		{
+			name: "conf.d directory",
+			main: `include = ["conf.d/*.toml"]` + oneRecord,
+			files: map[string]string{
+				"conf.d/a.toml": "[[records]]\n  zone = \"a.example\"\n  record = \"@\"\n  type = \"SOA\"\n",
+				"conf.d/b.toml": "[[records]]\n  zone = \"b.example\"\n  record = \"@\"\n  type = \"SOA\"\n",
+			},
+			wantRecords: 3,
+		},
+		{
+			name:        "glob that matches nothing",
+			main:        `include = ["conf.d/*.toml"]` + oneRecord,
+			wantRecords: 1,
+		},
+		{
+			name: "duplicate across files",
+			main: `include = ["conf.d/*.toml"]` + oneRecord,
+			files: map[string]string{
+				"conf.d/team.toml": oneRecord,
+			},
+			wantErr: []string{"configured more than once", "dnssec-checks and in ", "team.toml"},
+		},
+		{
+			name: "error in an included file",
+			main: `include = ["team.toml"]` + oneRecord,
+			files: map[string]string{
+				"team.toml": "[[zones]]\n  zone = \"example.com\"\n  key = \"missing.\"\n",
+			},
+			wantErr: []string{"team.toml: zone example.com uses key"},
+		},
+		{
+			name: "unknown key in an included file",
+			main: `include = ["team.toml"]` + oneRecord,
+			files: map[string]string{
+				"team.toml": "[[records]]\n  zne = \"example.com\"\n",
+			},
+			wantErr: []string{"team.toml has unknown keys"},
+		},
+		{
+			name:    "missing file",
+			main:    `include = ["team.toml"]` + oneRecord,
+			wantErr: []string{"open configuration file", "team.toml"},
+		},
+		{
+			name: "include loop",
+			main: `include = ["team.toml"]` + oneRecord,
+			files: map[string]string{
+				"team.toml": `include = ["dnssec-checks"]`,
+			},
+			wantErr: []string{"included more than once"},
+		},
+		{
+			name: "setting in an included file",
+			main: `include = ["team.toml"]` + oneRecord,
+			files: map[string]string{
+				"team.toml": "check_interval = \"1m\"\nwarn_days = 40\nmax_concurrency = 3\n",
+			},
+			wantErr: []string{"team.toml sets warn_days, check_interval, max_concurrency", "only the main configuration file"},
+		},
+		{
+			name: "zero setting in an included file",
+			main: `include = ["team.toml"]` + oneRecord,
+			files: map[string]string{
+				"team.toml": "critical_days = 0\n",
+			},
+			wantErr: []string{"team.toml sets critical_days"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "dnssec-checks")
+
+			writeConfig(t, path, tt.main)
+
+			for name, data := range tt.files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700); err != nil {
+					t.Fatalf("couldn't create directory: %v", err)
+				}
+
+				writeConfig(t, filepath.Join(dir, name), data)
+			}
+
+			e, err := loadExporter(path, time.Second, []string{"127.0.0.1:53"}, nullLogger())
+
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Fatalf("expected an error that contains %q, got: %v", want, err)
+					}
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if len(e.Records) != tt.wantRecords {
+				t.Fatalf("records = %v, want %d", e.Records, tt.wantRecords)
+			}
+		})
+	}
+
+}
+
+func TestValidateLabels(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		records    []Record
+		zones      []Zone
+		wantLabels []string
+		wantErr    string
+	}{
+		{
+			name:    "no labels",
+			records: []Record{{Zone: "example.org", Record: "@", Type: "SOA"}},
+		},
+		{
+			name: "labels from records and zones",
+			records: []Record{
+				{Zone: "example.org", Record: "@", Type: "SOA", Labels: map[string]string{"team": "payments"}},
+			},
+			zones:      []Zone{{Zone: "example.com", Labels: map[string]string{"env": "prod"}}},
+			wantLabels: []string{"env", "team"},
+		},
+		{
+			name:    "invalid name",
+			records: []Record{{Zone: "example.org", Record: "@", Type: "SOA", Labels: map[string]string{"cost-center": "x"}}},
+			wantErr: "not a valid label name",
+		},
+		{
+			name:    "reserved prefix",
+			zones:   []Zone{{Zone: "example.com", Labels: map[string]string{"__name__": "x"}}},
+			wantErr: "not a valid label name",
+		},
+		{
+			name:    "label the exporter sets",
+			records: []Record{{Zone: "example.org", Record: "@", Type: "SOA", Labels: map[string]string{"zone": "x"}}},
+			wantErr: "which the exporter sets itself",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+			e.Records = tt.records
+			e.Zones = tt.zones
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if !reflect.DeepEqual(e.labels, tt.wantLabels) {
+				t.Fatalf("labels = %v, want %v", e.labels, tt.wantLabels)
+			}
+		})
+	}
+
+}
+
+// variableLabels matches the label names in the string of a Desc.
+var variableLabels = regexp.MustCompile(`variableLabels: \{([^}]*)\}`)
+
+// A custom label with the name of a label of any metric would panic on the
+// first metric that carries both, so every such name must be refused.
+func TestValidateLabelsRefusesEveryMetricLabel(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		e.Describe(descs)
+		close(descs)
+	}()
+
+	// The buckets of a histogram carry le.
+	names := map[string]bool{"le": true}
+
+	for desc := range descs {
+		match := variableLabels.FindStringSubmatch(desc.String())
+		if match == nil {
+			t.Fatalf("couldn't find the labels of %v", desc)
+		}
+
+		for name := range strings.SplitSeq(match[1], ",") {
+			if name != "" {
+				names[name] = true
+			}
+		}
+	}
+
+	for name := range names {
+		t.Run(name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+			e.Records = []Record{{Zone: "example.org", Record: "@", Type: "SOA", Labels: map[string]string{name: "x"}}}
+
+			err := e.Validate()
+			if err == nil || !strings.Contains(err.Error(), "which the exporter sets itself") {
+				t.Fatalf("expected label %q to be refused, got: %v", name, err)
+			}
+		})
+	}
+
+}
+
+func TestValidateThresholds(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		warn     int
+		critical int
+		record   Record
+		wantErr  string
+	}{
+		{name: "defaults", record: Record{}},
+		{name: "entry sets both", record: Record{WarnDays: 7, CriticalDays: 3}},
+		{name: "entry sets a higher warning", record: Record{WarnDays: 60}},
+		{name: "file sets both", warn: 30, critical: 14, record: Record{}},
+		{name: "entry warns after critical", record: Record{WarnDays: 3, CriticalDays: 7}, wantErr: "must be more than critical_days"},
+		{name: "entry critical above the default warning", record: Record{CriticalDays: 30}, wantErr: "warn_days (20) must be more than critical_days (30)"},
+		{name: "file warns after critical", warn: 5, critical: 5, record: Record{}, wantErr: "must be more than critical_days"},
+		{name: "negative", record: Record{CriticalDays: -1}, wantErr: "must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+
+			if tt.warn != 0 {
+				e.WarnDays = tt.warn
+			}
+
+			if tt.critical != 0 {
+				e.CriticalDays = tt.critical
+			}
+
+			rec := tt.record
+			rec.Zone, rec.Record, rec.Type = "example.org", "@", "SOA"
+			e.Records = []Record{rec}
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+
+}
+
+func TestLoadExporterReadsCatalogs(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnssec-checks")
+	writeConfig(t, path, `
+[[catalogs]]
+  zone = "catalog.example"
+  server = "127.0.0.1:5353"
+  refresh = "15m"
+  labels = { team = "dns" }
+`)
+
+	e, err := loadExporter(path, time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if len(e.sources) != 1 || e.sources[0].refresh != 15*time.Minute {
+		t.Fatalf("expected one catalog source that refreshes every 15m, got %v", e.sources)
+	}
+
+	member := e.Catalogs[0].member("example.com")
+	if member.Server != "127.0.0.1:5353" || member.Labels["team"] != "dns" {
+		t.Fatalf("member = %+v, want the server and labels of the catalog", member)
+	}
+
+}
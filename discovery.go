@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultRefresh is how often a source of zones is read again when its entry
+// does not say.
+const defaultRefresh = 5 * time.Minute
+
+// zoneSource is a source of zones to monitor that the exporter reads again
+// every refresh interval, such as a catalog zone. It keeps the zones from the
+// last good read, so a failed read does not stop the checks of the zones it
+// found before.
+type zoneSource struct {
+	// kind is the kind of source, such as "catalog", and name identifies the
+	// source among those of its kind.
+	kind string
+	name string
+
+	refresh time.Duration
+	fetch   func(ctx context.Context) ([]Zone, error)
+
+	// labels are the custom labels of the entry that defines the source.
+	labels map[string]string
+
+	// addresses are the host:port addresses the source connects to, for
+	// -check-config to look up.
+	addresses []string
+
+	mu      sync.Mutex
+	zones   []Zone
+	fetched time.Time
+	ok      bool
+}
+
+// get returns the zones from the last good read. It reads the source first if
+// the last attempt is older than the refresh interval, and reports whether
+// that attempt succeeded.
+func (s *zoneSource) get(ctx context.Context, e *Exporter) ([]Zone, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.fetched.IsZero() && time.Since(s.fetched) < s.refresh {
+		return s.zones, s.ok
+	}
+
+	zones, err := s.fetch(ctx)
+
+	s.fetched = time.Now()
+	s.ok = err == nil
+
+	if err != nil {
+		e.logger.Error("zone discovery failed",
+			"discovery", s.kind,
+			"source", s.name,
+			"zones", len(s.zones),
+			"error", err,
+		)
+
+		// A source that could still read part of its zones, such as file_sd
+		// with one bad file, returns them with the error.
+		if zones == nil {
+			return s.zones, false
+		}
+
+		s.zones = zones
+
+		return zones, false
+	}
+
+	s.zones = zones
+
+	return zones, true
+}
+
+// invalidate makes the next get read the source again, whatever the refresh
+// interval, for a source that knows it has changed.
+func (s *zoneSource) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetched = time.Time{}
+}
+
+// zones returns the zones to transfer in this scrape: the [[zones]] entries,
+// followed by the zones from every source. A zone that is already monitored is
+// left out, so an entry in the file wins over a discovered one.
+func (e *Exporter) zones(ctx context.Context, ch chan<- prometheus.Metric) []Zone {
+	results := make([][]Zone, len(e.sources))
+
+	var wg sync.WaitGroup
+
+	for i, source := range e.sources {
+		wg.Go(func() {
+			zones, ok := source.get(ctx, e)
+
+			var success float64
+			if ok {
+				success = 1
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				e.discoverySuccess, prometheus.GaugeValue, success,
+				e.labelValues(source.labels, source.kind, source.name)...,
+			)
+
+			ch <- prometheus.MustNewConstMetric(
+				e.discoveredZones, prometheus.GaugeValue, float64(len(zones)),
+				e.labelValues(source.labels, source.kind, source.name)...,
+			)
+
+			results[i] = zones
+		})
+	}
+
+	wg.Wait()
+
+	zones := slices.Clone(e.Zones)
+	seen := make(map[string]bool, len(e.Zones))
+
+	for _, zone := range e.Zones {
+		seen[dns.Fqdn(zone.Zone)] = true
+	}
+
+	for _, discovered := range results {
+		for _, zone := range discovered {
+			if seen[dns.Fqdn(zone.Zone)] {
+				continue
+			}
+
+			seen[dns.Fqdn(zone.Zone)] = true
+
+			zones = append(zones, zone)
+		}
+	}
+
+	return zones
+}
+
+// zoneLabel returns a discovered zone name in the form a [[zones]] entry is
+// usually written, without the final dot, so the zone label matches.
+func zoneLabel(name string) string {
+	if name == "." {
+		return name
+	}
+
+	return strings.TrimSuffix(name, ".")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A source must be read again only after the refresh interval, and a failed
+// read must keep the zones from the last good one.
+func TestZoneSourceRefresh(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+
+	calls := 0
+	fail := false
+
+	source := &zoneSource{
+		kind:    "test",
+		name:    "test",
+		refresh: time.Hour,
+		fetch: func(context.Context) ([]Zone, error) {
+			calls++
+
+			if fail {
+				return nil, errors.New("unreachable")
+			}
+
+			return []Zone{{Zone: "example.com"}}, nil
+		},
+	}
+
+	zones, ok := source.get(t.Context(), e)
+	if !ok || len(zones) != 1 {
+		t.Fatalf("get() = %v, %v, want one zone and success", zones, ok)
+	}
+
+	source.get(t.Context(), e)
+
+	if calls != 1 {
+		t.Fatalf("the source was read %d times within the refresh interval, want 1", calls)
+	}
+
+	// Make the last read look old, and the next one fail.
+	source.fetched = time.Now().Add(-2 * time.Hour)
+	fail = true
+
+	zones, ok = source.get(t.Context(), e)
+	if ok || len(zones) != 1 {
+		t.Fatalf("get() = %v, %v after a failed read, want the last zones and failure", zones, ok)
+	}
+
+	if calls != 2 {
+		t.Fatalf("the source was read %d times, want 2", calls)
+	}
+
+}
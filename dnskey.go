@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// keyID identifies a DNSKEY the way an RRSIG names the key that made it.
+type keyID struct {
+	tag       uint16
+	algorithm uint8
+}
+
+func (s signature) key() keyID {
+	return keyID{tag: s.keyTag, algorithm: s.algorithm}
+}
+
+// keySets holds the DNSKEY sets that one check has queried, so the records of
+// a zone query its DNSKEY set once on each resolver rather than once each.
+type keySets struct {
+	mu   sync.Mutex
+	sets map[string]*keySet
+}
+
+type keySet struct {
+	once sync.Once
+	keys map[keyID]bool
+	err  error
+}
+
+func newKeySets() *keySets {
+	return &keySets{sets: make(map[string]*keySet)}
+}
+
+// get returns the DNSKEY set of zone on resolver, and queries it the first
+// time it is asked for.
+func (s *keySets) get(ctx context.Context, e *Exporter, resolver Resolver, zone string) (map[keyID]bool, error) {
+	zone = dns.CanonicalName(zone)
+
+	s.mu.Lock()
+	set, ok := s.sets[resolver.Name+" "+zone]
+	if !ok {
+		set = &keySet{}
+		s.sets[resolver.Name+" "+zone] = set
+	}
+	s.mu.Unlock()
+
+	set.once.Do(func() {
+		set.keys, set.err = e.dnskeys(ctx, resolver, zone)
+	})
+
+	return set.keys, set.err
+}
+
+// dnskeys queries the DNSKEY set of zone on resolver.
+func (e *Exporter) dnskeys(ctx context.Context, resolver Resolver, zone string) (map[keyID]bool, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(zone, dns.TypeDNSKEY)
+	msg.SetEdns0(4096, true)
+
+	response, err := e.exchange(ctx, msg, resolver)
+	if err != nil {
+		return nil, fmt.Errorf("query the DNSKEY set of %s: %w", zone, err)
+	}
+
+	if failure := queryFailure(response, nil); failure != "" {
+		return nil, fmt.Errorf("query the DNSKEY set of %s: %s", zone, failure)
+	}
+
+	keys := make(map[keyID]bool)
+
+	for _, rr := range response.Answer {
+		if key, ok := rr.(*dns.DNSKEY); ok && dns.CanonicalName(key.Hdr.Name) == zone {
+			keys[keyID{tag: key.KeyTag(), algorithm: key.Algorithm}] = true
+		}
+	}
+
+	return keys, nil
+}
+
+// orphanedRRSIGs returns the number of sigs that were made by a key that the
+// DNSKEY set of their signer on resolver does not have. A validator cannot
+// use such a signature.
+func (e *Exporter) orphanedRRSIGs(ctx context.Context, sets *keySets, resolver Resolver, sigs []signature) (int, error) {
+	var orphaned int
+
+	for _, sig := range sigs {
+		keys, err := sets.get(ctx, e, resolver, sig.signer)
+		if err != nil {
+			return 0, err
+		}
+
+		if !keys[sig.key()] {
+			orphaned++
+		}
+	}
+
+	return orphaned, nil
+}
@@ -3,32 +3,129 @@ package main
 import (
 	"context"
 	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Exporter collects DNSSEC signature data at scrape time. It holds no metric
-// state between scrapes, so a failed query makes the affected series absent
-// instead of leaving a stale value behind.
+// Exporter collects DNSSEC signature data at scrape time, or with a check
+// interval, in the background. It keeps no metric from one check to the next,
+// so a failed query makes the affected series absent instead of leaving a stale
+// value behind.
 type Exporter struct {
-	Records []Record
-	Zones   []Zone
-	Keys    []Key
+	Records   []Record
+	Zones     []Zone
+	Keys      []Key
+	Resolvers []Resolver
+	Catalogs  []Catalog
+	PowerDNS  []PowerDNS
 
-	daysLeft  *prometheus.Desc
-	resolves  *prometheus.Desc
-	expiry    *prometheus.Desc
-	transfers *prometheus.Desc
+	ServerConfigs []ServerConfig
+	FileSD        []FileSD
+
+	// Modules set how /probe checks a target.
+	Modules []Module
+
+	// WarnDays and CriticalDays are the expiry thresholds of the entries that
+	// set none.
+	WarnDays     int
+	CriticalDays int
+
+	// CheckInterval runs the checks in the background this often, and makes a
+	// scrape serve the result of the last one. Without it, every scrape runs
+	// the checks.
+	CheckInterval time.Duration
+
+	// checked holds the metrics of the last background check.
+	checked atomic.Pointer[checkResult]
+
+	// MaxConcurrency limits the queries and zone transfers in flight. Zero is
+	// no limit.
+	MaxConcurrency int
+
+	// limits holds the limits on queries, and counts the queries that wait for
+	// them.
+	limits *queryLimits
+
+	// instruments are the metrics about the queries and transfers themselves.
+	instruments *instruments
+
+	// history holds the last success and the failures of every target.
+	history *history
+
+	daysLeft      *prometheus.Desc
+	resolves      *prometheus.Desc
+	expiry        *prometheus.Desc
+	transfers     *prometheus.Desc
+	thresholdDays *prometheus.Desc
+	queryError    *prometheus.Desc
+	rrsigExpiry   *prometheus.Desc
+
+	recordOrphaned *prometheus.Desc
+	zoneOrphaned   *prometheus.Desc
+	rcode          *prometheus.Desc
+	flag           *prometheus.Desc
+	transferError  *prometheus.Desc
+
+	recordLastSuccess   *prometheus.Desc
+	recordFailures      *prometheus.Desc
+	transferLastSuccess *prometheus.Desc
+	transferFailures    *prometheus.Desc
+
+	zoneSerial       *prometheus.Desc
+	zoneRRsets       *prometheus.Desc
+	zoneRRSIGs       *prometheus.Desc
+	zoneRecords      *prometheus.Desc
+	zoneExpiring     *prometheus.Desc
+	transferBytes    *prometheus.Desc
+	transferMessages *prometheus.Desc
+	signatureExpiry  *prometheus.Desc
+	signatureDays    *prometheus.Desc
+	kindExpiry       *prometheus.Desc
+	zonemdVerified   *prometheus.Desc
+	zonemdSerial     *prometheus.Desc
+
+	discoverySuccess *prometheus.Desc
+	discoveredZones  *prometheus.Desc
+	lastCheck        *prometheus.Desc
+	queriesQueued    *prometheus.Desc
+	queriesInFlight  *prometheus.Desc
+
+	// sources find more zones to monitor, such as the members of a catalog.
+	sources []*zoneSource
+
+	// fileSD holds the records and zones read from the files of every
+	// [[file_sd]] entry.
+	fileSD []*fileSD
+
+	// labels are the names of the custom labels, in the order the descriptions
+	// list them.
+	labels []string
+
+	// reservedLabels are the labels that the descriptions set themselves. A
+	// custom label with one of these names would make two labels with the
+	// same name.
+	reservedLabels map[string]bool
 
 	// keys indexes Keys by name, so a zone can name the key it needs.
 	keys map[string]Key
 
-	resolvers []string
-	dnsClient *dns.Client
-	timeout   time.Duration
+	// modules indexes Modules by name.
+	modules map[string]Module
+
+	// resolvers are the resolvers in use: the [[resolvers]] table when the
+	// configuration file has one, or the -resolvers list.
+	resolvers []Resolver
+
+	// clients holds a DNS client for each transport a resolver can use.
+	clients map[string]*dns.Client
+	timeout time.Duration
 
 	logger *slog.Logger
 }
@@ -36,39 +133,270 @@ type Exporter struct {
 var _ prometheus.Collector = (*Exporter)(nil)
 
 func NewDNSSECExporter(timeout time.Duration, resolvers []string, logger *slog.Logger) *Exporter {
-	return &Exporter{
-		daysLeft: prometheus.NewDesc(
-			"dnssec_zone_record_days_left",
-			"Number of days the signature will be valid",
-			[]string{"zone", "record", "type"},
-			nil,
-		),
-		resolves: prometheus.NewDesc(
-			"dnssec_zone_record_resolves",
-			"Does the record resolve using the specified DNSSEC enabled resolvers",
-			[]string{"resolver", "zone", "record", "type"},
-			nil,
-		),
-		expiry: prometheus.NewDesc(
-			"dnssec_zone_record_earliest_rrsig_expiry",
-			"Earliest expiring RRSIG covering the record on resolver in unixtime",
-			[]string{"resolver", "zone", "record", "type"},
-			nil,
-		),
-		transfers: prometheus.NewDesc(
-			"dnssec_zone_transfer_success",
-			"Did the zone transfer from the configured server succeed",
-			[]string{"server", "zone"},
-			nil,
-		),
-		dnsClient: &dns.Client{
-			Net:     "tcp",
-			Timeout: timeout,
-		},
-		resolvers: resolvers,
+	e := &Exporter{
+		WarnDays:     defaultWarnDays,
+		CriticalDays: defaultCriticalDays,
+
+		clients:   make(map[string]*dns.Client, len(transports)),
+		resolvers: make([]Resolver, 0, len(resolvers)),
 		timeout:   timeout,
 		logger:    logger,
 	}
+
+	e.newDescs(nil)
+
+	for transport := range transports {
+		e.clients[transport] = &dns.Client{
+			Net:     transport,
+			Timeout: timeout,
+		}
+	}
+
+	for _, address := range resolvers {
+		e.resolvers = append(e.resolvers, Resolver{Name: address, Address: address, Transport: "tcp"})
+	}
+
+	e.limits = newQueryLimits(0, e.resolvers)
+	e.instruments = newInstruments()
+	e.history = newHistory()
+
+	return e
+}
+
+// newDescs builds the metric descriptions. labels are the names of the custom
+// labels from the configuration file, which every metric carries after its own.
+func (e *Exporter) newDescs(labels []string) {
+	e.labels = labels
+	e.reservedLabels = make(map[string]bool)
+
+	// own returns the labels of a description, its own names followed by the
+	// custom labels, and reserves its own names.
+	own := func(names ...string) []string {
+		for _, name := range names {
+			e.reservedLabels[name] = true
+		}
+
+		return append(names, labels...)
+	}
+
+	e.daysLeft = prometheus.NewDesc(
+		"dnssec_zone_record_days_left",
+		"Number of days the signature will be valid",
+		own("zone", "record", "type"),
+		nil,
+	)
+	e.resolves = prometheus.NewDesc(
+		"dnssec_zone_record_resolves",
+		"Does the record resolve using the specified DNSSEC enabled resolvers",
+		own("resolver", "zone", "record", "type"),
+		nil,
+	)
+	e.expiry = prometheus.NewDesc(
+		"dnssec_zone_record_earliest_rrsig_expiry",
+		"Earliest expiring RRSIG covering the record on resolver in unixtime",
+		own("resolver", "zone", "record", "type"),
+		nil,
+	)
+	e.transfers = prometheus.NewDesc(
+		"dnssec_zone_transfer_success",
+		"Did the zone transfer from the configured server succeed",
+		own("server", "zone"),
+		nil,
+	)
+	e.thresholdDays = prometheus.NewDesc(
+		"dnssec_zone_record_threshold_days",
+		"Number of days left below which the signature expiry is an alert of this severity",
+		own("zone", "record", "type", "severity"),
+		nil,
+	)
+	e.queryError = prometheus.NewDesc(
+		"dnssec_zone_record_query_error",
+		"Why the query of the record on resolver gave no signature to check",
+		own("resolver", "zone", "record", "type", "reason"),
+		nil,
+	)
+	e.rrsigExpiry = prometheus.NewDesc(
+		"dnssec_zone_record_rrsig_expiry",
+		"Expiry of an RRSIG covering the record on resolver in unixtime",
+		own("resolver", "zone", "record", "type", "key_tag", "algorithm", "signer"),
+		nil,
+	)
+	e.recordOrphaned = prometheus.NewDesc(
+		"dnssec_zone_record_orphaned_rrsigs",
+		"Number of RRSIGs covering the record on resolver made by a key that the DNSKEY set of the signer does not have",
+		own("resolver", "zone", "record", "type"),
+		nil,
+	)
+	e.zoneOrphaned = prometheus.NewDesc(
+		"dnssec_zone_orphaned_rrsigs",
+		"Number of RRSIGs in the zone transferred from the configured server made by a key that the DNSKEY set of the zone does not have",
+		own("server", "zone"),
+		nil,
+	)
+	e.rcode = prometheus.NewDesc(
+		"dnssec_zone_record_response_rcode",
+		"Response code of the query of the record on resolver, in the rcode label",
+		own("resolver", "zone", "record", "type", "rcode"),
+		nil,
+	)
+	e.flag = prometheus.NewDesc(
+		"dnssec_zone_record_response_flag",
+		"Is the header flag set in the response to the query of the record on resolver",
+		own("resolver", "zone", "record", "type", "flag"),
+		nil,
+	)
+	e.transferError = prometheus.NewDesc(
+		"dnssec_zone_transfer_error",
+		"Why the zone transfer from the configured server gave no signature to check",
+		own("server", "zone", "reason"),
+		nil,
+	)
+	e.recordLastSuccess = prometheus.NewDesc(
+		"dnssec_zone_record_last_success_timestamp_seconds",
+		"Time the last check of the record on resolver that found a signature finished",
+		own("resolver", "zone", "record", "type"),
+		nil,
+	)
+	e.recordFailures = prometheus.NewDesc(
+		"dnssec_zone_record_consecutive_failures",
+		"Number of checks of the record on resolver that found no signature since the last that did",
+		own("resolver", "zone", "record", "type"),
+		nil,
+	)
+	e.transferLastSuccess = prometheus.NewDesc(
+		"dnssec_zone_transfer_last_success_timestamp_seconds",
+		"Time the last transfer of the zone from the configured server that found a signature finished",
+		own("server", "zone"),
+		nil,
+	)
+	e.transferFailures = prometheus.NewDesc(
+		"dnssec_zone_transfer_consecutive_failures",
+		"Number of transfers of the zone from the configured server that found no signature since the last that did",
+		own("server", "zone"),
+		nil,
+	)
+	e.zoneSerial = prometheus.NewDesc(
+		"dnssec_zone_soa_serial",
+		"Serial of the SOA of the zone transferred from the configured server",
+		own("server", "zone"),
+		nil,
+	)
+	e.zoneRRsets = prometheus.NewDesc(
+		"dnssec_zone_rrsets",
+		"Number of RRsets in the zone transferred from the configured server, not counting RRSIGs",
+		own("server", "zone"),
+		nil,
+	)
+	e.zoneRRSIGs = prometheus.NewDesc(
+		"dnssec_zone_rrsigs",
+		"Number of RRSIG records in the zone transferred from the configured server",
+		own("server", "zone"),
+		nil,
+	)
+	e.zoneRecords = prometheus.NewDesc(
+		"dnssec_zone_records",
+		"Number of records of the type in the zone transferred from the configured server",
+		own("server", "zone", "type"),
+		nil,
+	)
+	e.zoneExpiring = prometheus.NewDesc(
+		"dnssec_zone_signatures_expiring",
+		"Number of RRSIGs in the zone transferred from the configured server that expire within the days",
+		own("server", "zone", "days"),
+		nil,
+	)
+	e.transferBytes = prometheus.NewDesc(
+		"dnssec_zone_transfer_bytes",
+		"Number of bytes the zone transfer from the configured server read",
+		own("server", "zone"),
+		nil,
+	)
+	e.transferMessages = prometheus.NewDesc(
+		"dnssec_zone_transfer_messages",
+		"Number of DNS messages the zone transfer from the configured server read",
+		own("server", "zone"),
+		nil,
+	)
+	e.signatureExpiry = prometheus.NewDesc(
+		"dnssec_zone_signature_expiry",
+		"Expiry of one of the RRSIGs that expire first in the zone transferred from the configured server in unixtime",
+		own("server", "zone", "record", "type", "key_tag"),
+		nil,
+	)
+	e.signatureDays = prometheus.NewDesc(
+		"dnssec_zone_signature_days_left",
+		"Number of days the RRSIGs in the zone transferred from the configured server will be valid",
+		own("server", "zone"),
+		nil,
+	)
+	// The buckets of the histogram carry le.
+	e.reservedLabels["le"] = true
+
+	e.kindExpiry = prometheus.NewDesc(
+		"dnssec_zone_earliest_rrsig_expiry",
+		"Earliest expiring RRSIG covering a type of the kind in the zone transferred from the configured server in unixtime",
+		own("server", "zone", "covered", "record", "type"),
+		nil,
+	)
+	e.zonemdVerified = prometheus.NewDesc(
+		"dnssec_zone_zonemd_verified",
+		"Does a ZONEMD of the zone transferred from the configured server match the zone",
+		own("server", "zone"),
+		nil,
+	)
+	e.zonemdSerial = prometheus.NewDesc(
+		"dnssec_zone_zonemd_serial",
+		"Serial of the ZONEMD of the zone transferred from the configured server",
+		own("server", "zone"),
+		nil,
+	)
+	e.discoverySuccess = prometheus.NewDesc(
+		"dnssec_discovery_success",
+		"Did the last attempt to read the zones from the source succeed",
+		own("discovery", "source"),
+		nil,
+	)
+	e.discoveredZones = prometheus.NewDesc(
+		"dnssec_discovery_zones",
+		"Number of zones that the source lists",
+		own("discovery", "source"),
+		nil,
+	)
+	e.lastCheck = prometheus.NewDesc(
+		"dnssec_exporter_last_check_timestamp_seconds",
+		"Time the background check that the metrics come from finished",
+		nil,
+		nil,
+	)
+	e.queriesQueued = prometheus.NewDesc(
+		"dnssec_exporter_queries_queued",
+		"Number of queries and zone transfers that wait for a concurrency or rate limit",
+		[]string{"resolver"},
+		nil,
+	)
+	e.queriesInFlight = prometheus.NewDesc(
+		"dnssec_exporter_queries_in_flight",
+		"Number of queries and zone transfers in flight",
+		[]string{"resolver"},
+		nil,
+	)
+}
+
+// checkResult is the outcome of one background check.
+type checkResult struct {
+	metrics []prometheus.Metric
+	time    time.Time
+}
+
+// labelValues returns values followed by the value of every custom label. An
+// entry that does not set a label reports it empty, which Prometheus reads as
+// the label not being there.
+func (e *Exporter) labelValues(labels map[string]string, values ...string) []string {
+	for _, name := range e.labels {
+		values = append(values, labels[name])
+	}
+
+	return values
 }
 
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
@@ -76,47 +404,260 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.resolves
 	ch <- e.expiry
 	ch <- e.transfers
+	ch <- e.thresholdDays
+	ch <- e.queryError
+	ch <- e.rrsigExpiry
+	ch <- e.recordOrphaned
+	ch <- e.zoneOrphaned
+	ch <- e.rcode
+	ch <- e.flag
+	ch <- e.transferError
+	ch <- e.recordLastSuccess
+	ch <- e.recordFailures
+	ch <- e.transferLastSuccess
+	ch <- e.transferFailures
+	ch <- e.zoneSerial
+	ch <- e.zoneRRsets
+	ch <- e.zoneRRSIGs
+	ch <- e.zoneRecords
+	ch <- e.zoneExpiring
+	ch <- e.transferBytes
+	ch <- e.transferMessages
+	ch <- e.signatureExpiry
+	ch <- e.signatureDays
+	ch <- e.kindExpiry
+	ch <- e.zonemdVerified
+	ch <- e.zonemdSerial
+	ch <- e.discoverySuccess
+	ch <- e.discoveredZones
+	ch <- e.lastCheck
+	ch <- e.queriesQueued
+	ch <- e.queriesInFlight
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	e.collectQueries(ch)
+
+	if e.CheckInterval > 0 {
+		e.collectChecked(ch)
+		return
+	}
+
+	// The timeout bounds each query and transfer rather than the scrape, so a
+	// query that waits for a limit does not use up the time of the query.
+	e.check(context.Background(), ch)
+}
+
+// collectQueries reports the queries that wait for a limit and that are in
+// flight, for each resolver and each server that zones are transferred from.
+// Without a limit no query waits, and it reports nothing.
+func (e *Exporter) collectQueries(ch chan<- prometheus.Metric) {
+	if !e.limits.limited() {
+		return
+	}
+
+	targets, counts := e.limits.snapshot()
+
+	for i, target := range targets {
+		ch <- prometheus.MustNewConstMetric(
+			e.queriesQueued, prometheus.GaugeValue, float64(counts[i].queued), target,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			e.queriesInFlight, prometheus.GaugeValue, float64(counts[i].inFlight), target,
+		)
+	}
+}
+
+// collectChecked serves the metrics of the last background check. Before the
+// first check has finished, nothing has been measured, and it serves nothing.
+func (e *Exporter) collectChecked(ch chan<- prometheus.Metric) {
+	checked := e.checked.Load()
+	if checked == nil {
+		return
+	}
+
+	for _, m := range checked.metrics {
+		ch <- m
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		e.lastCheck, prometheus.GaugeValue, float64(checked.time.UnixNano())/1e9,
+	)
+}
+
+// checkOnce runs every check and keeps the metrics for the scrapes until the
+// next check. The check has until the next is due: the timeout bounds each
+// query and transfer, not the time they wait for a limit.
+func (e *Exporter) checkOnce(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.CheckInterval)
 	defer cancel()
 
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+
+	var metrics []prometheus.Metric
+
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+
+		close(done)
+	}()
+
+	e.check(ctx, ch)
+	close(ch)
+	<-done
+
+	e.checked.Store(&checkResult{metrics: metrics, time: time.Now()})
+}
+
+// check runs every check, and sends the metrics to ch.
+func (e *Exporter) check(ctx context.Context, ch chan<- prometheus.Metric) {
 	var wg sync.WaitGroup
 
-	for _, rec := range e.Records {
-		for _, resolver := range e.resolvers {
+	round := e.history.begin()
+
+	// The sources are read first, because file_sd adds records as well as
+	// zones.
+	zones := e.zones(ctx, ch)
+
+	keys := newKeySets()
+
+	for _, rec := range e.records() {
+		for i, resolver := range e.resolversFor(rec) {
 			wg.Go(func() {
-				e.collectRecord(ctx, ch, rec, resolver)
+				e.collectRecord(ctx, ch, rec, resolver, keys, i == 0)
 			})
 		}
 	}
 
-	for _, zone := range e.Zones {
+	for _, zone := range zones {
 		wg.Go(func() {
 			e.collectZone(ctx, ch, zone)
 		})
 	}
 
 	wg.Wait()
+
+	// Every check adds its target to the history, also when it fails, so the
+	// targets that this round left out are not checked anymore.
+	e.history.prune(round)
+}
+
+// Run does the work of the exporter that is not part of a scrape, until ctx is
+// done: it watches the files of every [[file_sd]] entry, and with a check
+// interval, runs the checks.
+func (e *Exporter) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, sd := range e.fileSD {
+		wg.Go(func() {
+			sd.watch(ctx, e.logger)
+		})
+	}
+
+	if e.CheckInterval > 0 {
+		wg.Go(func() {
+			e.checkEvery(ctx)
+		})
+	}
+
+	wg.Wait()
+}
+
+// checkEvery runs the checks every check interval until ctx is done. The first
+// check runs at once, unless one has run already, such as before a reload put
+// the exporter in use.
+func (e *Exporter) checkEvery(ctx context.Context) {
+	var next time.Time
+	if checked := e.checked.Load(); checked != nil {
+		next = checked.time.Add(e.CheckInterval)
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+
+		case <-timer.C:
+		}
+
+		e.checkOnce(ctx)
+
+		next = time.Now().Add(e.CheckInterval)
+	}
+}
+
+// resolversFor returns the resolvers that check rec, in configuration order.
+func (e *Exporter) resolversFor(rec Record) []Resolver {
+	if len(rec.Groups) == 0 {
+		return e.resolvers
+	}
+
+	var resolvers []Resolver
+
+	for _, res := range e.resolvers {
+		if slices.ContainsFunc(res.Groups, func(group string) bool {
+			return slices.Contains(rec.Groups, group)
+		}) {
+			resolvers = append(resolvers, res)
+		}
+	}
+
+	return resolvers
 }
 
-func (e *Exporter) collectRecord(ctx context.Context, ch chan<- prometheus.Metric, rec Record, resolver string) {
-	resolves, expires := e.resolve(ctx, rec, resolver)
+// collectRecord checks rec on one resolver. The first resolver that checks the
+// record also reports days_left.
+func (e *Exporter) collectRecord(ctx context.Context, ch chan<- prometheus.Metric, rec Record, resolver Resolver, keys *keySets, first bool) {
+	ans := e.resolve(ctx, rec, resolver)
+
+	if ans.failure != "" {
+		ch <- prometheus.MustNewConstMetric(
+			e.queryError, prometheus.GaugeValue, 1,
+			e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type, ans.failure)...,
+		)
+	}
+
+	e.collectOutcome(ch, e.recordLastSuccess, e.recordFailures,
+		"record "+resolver.Name+" "+rec.String(), ans.failure == "",
+		e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type),
+	)
+
+	if ans.header != nil {
+		e.collectHeader(ch, rec, resolver, ans.header)
+	}
 
 	var resolvesValue float64
-	if resolves {
+	if ans.resolves {
 		resolvesValue = 1
 	}
 
 	ch <- prometheus.MustNewConstMetric(
 		e.resolves, prometheus.GaugeValue, resolvesValue,
-		resolver, rec.Zone, rec.Record, rec.Type,
+		e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type)...,
 	)
 
+	if rec.CheckOrphans && len(ans.rrsigs) > 0 {
+		e.collectOrphaned(ctx, ch, rec, resolver, keys, ans.rrsigs)
+	}
+
+	for _, sig := range ans.signatures {
+		ch <- prometheus.MustNewConstMetric(
+			e.rrsigExpiry, prometheus.GaugeValue, float64(sig.expires.Unix()),
+			e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type,
+				strconv.Itoa(int(sig.keyTag)), algorithmName(sig.algorithm), sig.signer)...,
+		)
+	}
+
 	// Without an RRSIG there is nothing to measure, so leave both signature
 	// metrics absent rather than reporting a value derived from the zero time.
-	if expires.IsZero() {
+	if ans.expires.IsZero() {
 		return
 	}
 
@@ -124,28 +665,99 @@ func (e *Exporter) collectRecord(ctx context.Context, ch chan<- prometheus.Metri
 	// do not validate. Report the expiry whenever the response carried an RRSIG
 	// so those servers can be monitored too.
 	ch <- prometheus.MustNewConstMetric(
-		e.expiry, prometheus.GaugeValue, float64(expires.Unix()),
-		resolver, rec.Zone, rec.Record, rec.Type,
+		e.expiry, prometheus.GaugeValue, float64(ans.expires.Unix()),
+		e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type)...,
 	)
 
 	// For compatibility with historical behaviour, record_days_left reports the
-	// time until the earliest RRSIG expiration on the first configured resolver.
-	if resolver == e.resolvers[0] {
+	// time until the earliest RRSIG expiration on the first resolver that checks
+	// the record.
+	if first {
+		ch <- prometheus.MustNewConstMetric(
+			e.daysLeft, prometheus.GaugeValue, time.Until(ans.expires).Hours()/24,
+			e.labelValues(rec.Labels, rec.Zone, rec.Record, rec.Type)...,
+		)
+
+		e.collectThresholds(ch, rec)
+	}
+}
+
+// collectOrphaned reports how many of the RRSIGs that cover rec on resolver
+// were made by a key that the DNSKEY set does not have. Without the DNSKEY set
+// it cannot tell, and reports nothing.
+func (e *Exporter) collectOrphaned(ctx context.Context, ch chan<- prometheus.Metric, rec Record, resolver Resolver, keys *keySets, rrsigs []signature) {
+	orphaned, err := e.orphanedRRSIGs(ctx, keys, resolver, rrsigs)
+	if err != nil {
+		e.logger.Warn("cannot check the keys of the signatures",
+			"record", rec.String(),
+			"resolver", resolver.Name,
+			"error", err,
+		)
+
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		e.recordOrphaned, prometheus.GaugeValue, float64(orphaned),
+		e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type)...,
+	)
+}
+
+// collectOutcome adds a check of target to the history, and reports when a
+// check of it last succeeded and how many have failed since. A target that has
+// never succeeded has no last success to report.
+func (e *Exporter) collectOutcome(ch chan<- prometheus.Metric, lastSuccess, failures *prometheus.Desc, target string, success bool, labelValues []string) {
+	o := e.history.add(target, success, time.Now())
+
+	if !o.lastSuccess.IsZero() {
 		ch <- prometheus.MustNewConstMetric(
-			e.daysLeft, prometheus.GaugeValue, time.Until(expires).Hours()/24,
-			rec.Zone, rec.Record, rec.Type,
+			lastSuccess, prometheus.GaugeValue, float64(o.lastSuccess.UnixNano())/1e9, labelValues...,
+		)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		failures, prometheus.GaugeValue, float64(o.failures), labelValues...,
+	)
+}
+
+// collectHeader reports the rcode and the flags of the response to the query of
+// rec on resolver, so a record that stopped resolving shows why: an NXDOMAIN
+// after a deployment reads differently from a SERVFAIL of a broken chain.
+func (e *Exporter) collectHeader(ch chan<- prometheus.Metric, rec Record, resolver Resolver, header *dns.MsgHdr) {
+	ch <- prometheus.MustNewConstMetric(
+		e.rcode, prometheus.GaugeValue, 1,
+		e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type, rcodeName(header.Rcode))...,
+	)
+
+	flags := []struct {
+		name string
+		set  bool
+	}{
+		{"aa", header.Authoritative},
+		{"tc", header.Truncated},
+		{"ad", header.AuthenticatedData},
+		{"cd", header.CheckingDisabled},
+	}
+
+	for _, flag := range flags {
+		var value float64
+		if flag.set {
+			value = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			e.flag, prometheus.GaugeValue, value,
+			e.labelValues(rec.Labels, resolver.Name, rec.Zone, rec.Record, rec.Type, flag.name)...,
 		)
 	}
 }
 
 // collectZone transfers a zone and reports the record that expires first.
 func (e *Exporter) collectZone(ctx context.Context, ch chan<- prometheus.Metric, zone Zone) {
-	server := zone.Server
-	if server == "" {
-		server = e.resolvers[0]
-	}
+	server := e.zoneServer(zone)
 
-	earliest, err := e.transfer(ctx, zone, server)
+	stats, err := e.transfer(ctx, zone, server)
+	earliest := stats.earliest
 
 	var success float64
 	if err == nil {
@@ -160,22 +772,167 @@ func (e *Exporter) collectZone(ctx context.Context, ch chan<- prometheus.Metric,
 
 	ch <- prometheus.MustNewConstMetric(
 		e.transfers, prometheus.GaugeValue, success,
-		server, zone.Zone,
+		e.labelValues(zone.Labels, server, zone.Zone)...,
+	)
+
+	if err == nil {
+		e.collectZoneStats(ch, zone, server, stats)
+	}
+
+	var failure string
+
+	switch {
+	case err != nil:
+		failure = transferFailure(err)
+	case earliest.expires.IsZero():
+		failure = "no_rrsig"
+	}
+
+	e.collectOutcome(ch, e.transferLastSuccess, e.transferFailures,
+		"zone "+server+" "+dns.Fqdn(zone.Zone), failure == "",
+		e.labelValues(zone.Labels, server, zone.Zone),
 	)
 
 	// A zone with no signed record has nothing to report. Leave the signature
 	// metrics absent rather than reporting a value that was never measured.
-	if err != nil || earliest.expires.IsZero() {
+	if failure != "" {
+		ch <- prometheus.MustNewConstMetric(
+			e.transferError, prometheus.GaugeValue, 1,
+			e.labelValues(zone.Labels, server, zone.Zone, failure)...,
+		)
+
 		return
 	}
 
 	ch <- prometheus.MustNewConstMetric(
 		e.expiry, prometheus.GaugeValue, float64(earliest.expires.Unix()),
-		server, zone.Zone, earliest.record, earliest.recordType,
+		e.labelValues(zone.Labels, server, zone.Zone, earliest.record, earliest.recordType)...,
 	)
 
 	ch <- prometheus.MustNewConstMetric(
 		e.daysLeft, prometheus.GaugeValue, time.Until(earliest.expires).Hours()/24,
-		zone.Zone, earliest.record, earliest.recordType,
+		e.labelValues(zone.Labels, zone.Zone, earliest.record, earliest.recordType)...,
+	)
+
+	// The thresholds carry the labels of the days_left series above, which
+	// names the earliest record, so an alert can match the two.
+	e.collectThresholds(ch, Record{
+		Zone:         zone.Zone,
+		Record:       earliest.record,
+		Type:         earliest.recordType,
+		Labels:       zone.Labels,
+		WarnDays:     zone.WarnDays,
+		CriticalDays: zone.CriticalDays,
+	})
+}
+
+// collectZoneStats reports what a transfer found in zone, also when no record in
+// it is signed.
+func (e *Exporter) collectZoneStats(ch chan<- prometheus.Metric, zone Zone, server string, stats zoneStats) {
+	labelValues := e.labelValues(zone.Labels, server, zone.Zone)
+
+	gauges := []struct {
+		desc  *prometheus.Desc
+		value float64
+	}{
+		{e.zoneSerial, float64(stats.serial)},
+		{e.zoneRRsets, float64(stats.rrsets)},
+		{e.zoneRRSIGs, float64(stats.rrsigs)},
+		{e.transferBytes, float64(stats.size.bytes)},
+		{e.transferMessages, float64(stats.size.messages)},
+		{e.zoneOrphaned, float64(stats.orphaned)},
+	}
+
+	for _, g := range gauges {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, g.value, labelValues...)
+	}
+
+	for _, recordType := range slices.Sorted(maps.Keys(stats.records)) {
+		ch <- prometheus.MustNewConstMetric(
+			e.zoneRecords, prometheus.GaugeValue, float64(stats.records[recordType]),
+			e.labelValues(zone.Labels, server, zone.Zone, recordType)...,
+		)
+	}
+
+	for i, days := range expiringDays {
+		ch <- prometheus.MustNewConstMetric(
+			e.zoneExpiring, prometheus.GaugeValue, float64(stats.expiring[i]),
+			e.labelValues(zone.Labels, server, zone.Zone, strconv.Itoa(days))...,
+		)
+	}
+
+	ch <- prometheus.MustNewConstHistogram(
+		e.signatureDays, stats.daysLeft.count, stats.daysLeft.sum, stats.daysLeft.buckets,
+		labelValues...,
+	)
+
+	if stats.zonemd != nil {
+		e.collectZONEMD(ch, *stats.zonemd, labelValues)
+	}
+
+	for _, kind := range slices.Sorted(maps.Keys(stats.earliestByKind)) {
+		sig := stats.earliestByKind[kind]
+
+		ch <- prometheus.MustNewConstMetric(
+			e.kindExpiry, prometheus.GaugeValue, float64(sig.expires.Unix()),
+			e.labelValues(zone.Labels, server, zone.Zone, kind, sig.record, sig.recordType)...,
+		)
+	}
+
+	for _, sig := range stats.signatures {
+		ch <- prometheus.MustNewConstMetric(
+			e.signatureExpiry, prometheus.GaugeValue, float64(sig.expires.Unix()),
+			e.labelValues(zone.Labels, server, zone.Zone, sig.record, sig.recordType, strconv.Itoa(int(sig.keyTag)))...,
+		)
+	}
+}
+
+// collectZONEMD reports the verification of the ZONEMD of a zone that asks for
+// it. A zone without a ZONEMD, or with none that the exporter can verify, does
+// not verify, because the zone was expected to have one.
+func (e *Exporter) collectZONEMD(ch chan<- prometheus.Metric, result zonemdResult, labelValues []string) {
+	var verified float64
+	if result.verified {
+		verified = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(e.zonemdVerified, prometheus.GaugeValue, verified, labelValues...)
+
+	if result.present {
+		ch <- prometheus.MustNewConstMetric(e.zonemdSerial, prometheus.GaugeValue, float64(result.serial), labelValues...)
+	}
+}
+
+// zoneServer returns the server to transfer zone from. It defaults to the first
+// resolver that does not use tcp-tls, because a transfer is plain TCP, or to ""
+// when every resolver does.
+func (e *Exporter) zoneServer(zone Zone) string {
+	if zone.Server != "" {
+		return zone.Server
+	}
+
+	for _, res := range e.resolvers {
+		if res.Transport != "tcp-tls" {
+			return res.Address
+		}
+	}
+
+	return ""
+}
+
+// collectThresholds reports the expiry thresholds of rec, with the same labels
+// as its days_left series and a severity. It is reported together with
+// days_left, so the two are either both there or both absent.
+func (e *Exporter) collectThresholds(ch chan<- prometheus.Metric, rec Record) {
+	warn, critical := e.thresholds(rec.WarnDays, rec.CriticalDays)
+
+	ch <- prometheus.MustNewConstMetric(
+		e.thresholdDays, prometheus.GaugeValue, float64(warn),
+		e.labelValues(rec.Labels, rec.Zone, rec.Record, rec.Type, "warning")...,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		e.thresholdDays, prometheus.GaugeValue, float64(critical),
+		e.labelValues(rec.Labels, rec.Zone, rec.Record, rec.Type, "critical")...,
 	)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -67,6 +68,12 @@ func TestUnreachableResolverReportsOnlyResolves(t *testing.T) {
 	e.Records = []Record{soaRecord()}
 
 	expected := `
+# HELP dnssec_zone_record_consecutive_failures Number of checks of the record on resolver that found no signature since the last that did
+# TYPE dnssec_zone_record_consecutive_failures gauge
+dnssec_zone_record_consecutive_failures{record="@",resolver="127.0.0.1:1",type="SOA",zone="example.org"} 1
+# HELP dnssec_zone_record_query_error Why the query of the record on resolver gave no signature to check
+# TYPE dnssec_zone_record_query_error gauge
+dnssec_zone_record_query_error{reason="connection_refused",record="@",resolver="127.0.0.1:1",type="SOA",zone="example.org"} 1
 # HELP dnssec_zone_record_resolves Does the record resolve using the specified DNSSEC enabled resolvers
 # TYPE dnssec_zone_record_resolves gauge
 dnssec_zone_record_resolves{record="@",resolver="127.0.0.1:1",type="SOA",zone="example.org"} 0
@@ -132,3 +139,204 @@ func TestRecordsAndZonesTogether(t *testing.T) {
 	}
 
 }
+
+// A record that names a resolver group must only be checked on the resolvers
+// in that group, and the series must carry the resolver name.
+func TestRecordGroupsSelectResolvers(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{expires: time.Unix(2000000000, 0)})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, nil, nullLogger())
+	e.Resolvers = []Resolver{
+		// The public resolver refuses connections, so a check on it would still
+		// report a resolves series.
+		{Name: "public", Address: "127.0.0.1:1", Groups: []string{"public"}},
+		{Name: "internal", Address: addr[0], Groups: []string{"internal"}},
+	}
+	e.Records = []Record{{Zone: "example.org", Record: "@", Type: "SOA", Groups: []string{"internal"}}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	expected := `
+# HELP dnssec_zone_record_resolves Does the record resolve using the specified DNSSEC enabled resolvers
+# TYPE dnssec_zone_record_resolves gauge
+dnssec_zone_record_resolves{record="@",resolver="internal",type="SOA",zone="example.org"} 1
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "dnssec_zone_record_resolves"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+	// The internal resolver is the first that checks the record, so it reports
+	// days_left even though it is not the first configured resolver.
+	if count := testutil.CollectAndCount(e, "dnssec_zone_record_days_left"); count != 1 {
+		t.Fatalf("expected one days_left series, got %d", count)
+	}
+
+}
+
+// A record that stops resolving must show the rcode of the response, so an
+// NXDOMAIN reads differently from a resolver that cannot be reached, which
+// reports no response at all.
+func TestResponseHeaderReported(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{rcode: dns.RcodeNameError})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, []string{addr[0], "127.0.0.1:1"}, nullLogger())
+	e.Records = []Record{soaRecord()}
+
+	expected := `
+# HELP dnssec_zone_record_response_flag Is the header flag set in the response to the query of the record on resolver
+# TYPE dnssec_zone_record_response_flag gauge
+dnssec_zone_record_response_flag{flag="aa",record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 0
+dnssec_zone_record_response_flag{flag="ad",record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 1
+dnssec_zone_record_response_flag{flag="cd",record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 0
+dnssec_zone_record_response_flag{flag="tc",record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 0
+# HELP dnssec_zone_record_response_rcode Response code of the query of the record on resolver, in the rcode label
+# TYPE dnssec_zone_record_response_rcode gauge
+dnssec_zone_record_response_rcode{rcode="nxdomain",record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 1
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"dnssec_zone_record_response_rcode", "dnssec_zone_record_response_flag"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+// Custom labels must reach every series of the entry that sets them. An entry
+// that does not set a label reports it empty, so all series keep the same
+// label names.
+func TestCustomLabels(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{expires: time.Unix(2000000000, 0)})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, addr, nullLogger())
+	e.Records = []Record{
+		{Zone: "example.org", Record: "@", Type: "SOA", Labels: map[string]string{"team": "payments", "env": "prod"}},
+		{Zone: "example.org", Record: "www", Type: "SOA", Labels: map[string]string{"team": "web"}},
+	}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	expected := `
+# HELP dnssec_zone_record_earliest_rrsig_expiry Earliest expiring RRSIG covering the record on resolver in unixtime
+# TYPE dnssec_zone_record_earliest_rrsig_expiry gauge
+dnssec_zone_record_earliest_rrsig_expiry{env="prod",record="@",resolver="` + addr[0] + `",team="payments",type="SOA",zone="example.org"} 2e+09
+dnssec_zone_record_earliest_rrsig_expiry{env="",record="www",resolver="` + addr[0] + `",team="web",type="SOA",zone="example.org"} 2e+09
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "dnssec_zone_record_earliest_rrsig_expiry"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+// The thresholds must carry the labels of the days_left series they belong to,
+// for a record and for the earliest record in a zone, so one alert can compare
+// every entry against its own threshold.
+func TestThresholdsMatchDaysLeft(t *testing.T) {
+
+	recordAddr, cancelRecord := runServer(t, opts{})
+	defer cancelRecord()
+
+	zoneAddr, cancelZone := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{time.Unix(2000000000, 0)},
+	})
+
+	defer cancelZone()
+
+	e := NewDNSSECExporter(2*time.Second, recordAddr, nullLogger())
+	e.Records = []Record{{Zone: "example.org", Record: "@", Type: "SOA", WarnDays: 7, CriticalDays: 3}}
+	e.Zones = []Zone{{Zone: "example.com", Server: zoneAddr}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	expected := `
+# HELP dnssec_zone_record_threshold_days Number of days left below which the signature expiry is an alert of this severity
+# TYPE dnssec_zone_record_threshold_days gauge
+dnssec_zone_record_threshold_days{record="@",severity="critical",type="SOA",zone="example.org"} 3
+dnssec_zone_record_threshold_days{record="@",severity="warning",type="SOA",zone="example.org"} 7
+dnssec_zone_record_threshold_days{record="a0.example.com.",severity="critical",type="A",zone="example.com"} 10
+dnssec_zone_record_threshold_days{record="a0.example.com.",severity="warning",type="A",zone="example.com"} 20
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "dnssec_zone_record_threshold_days"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+// With a check interval, a scrape must serve what the last background check
+// measured, and query nothing itself. Before the first check, nothing has been
+// measured, so nothing is served.
+func TestBackgroundCheckServesLastResult(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{expires: time.Unix(2000000000, 0)})
+
+	e := NewDNSSECExporter(time.Second, addr, nullLogger())
+	e.Records = []Record{soaRecord()}
+	e.CheckInterval = time.Hour
+
+	if n := testutil.CollectAndCount(e); n != 0 {
+		t.Fatalf("series before the first check = %d, want 0", n)
+	}
+
+	e.checkOnce(t.Context())
+
+	// A scrape after the resolver has gone must still serve the check.
+	cancel()
+
+	expected := `
+# HELP dnssec_zone_record_earliest_rrsig_expiry Earliest expiring RRSIG covering the record on resolver in unixtime
+# TYPE dnssec_zone_record_earliest_rrsig_expiry gauge
+dnssec_zone_record_earliest_rrsig_expiry{record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 2e+09
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "dnssec_zone_record_earliest_rrsig_expiry"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+	want := float64(e.checked.Load().time.UnixNano()) / 1e9
+
+	if got := testutil.ToFloat64(collectOne(t, e, "dnssec_exporter_last_check_timestamp_seconds")); got != want {
+		t.Fatalf("last_check_timestamp_seconds = %v, want %v", got, want)
+	}
+
+}
+
+func TestBackgroundCheckRuns(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, addr, nullLogger())
+	e.Records = []Record{soaRecord()}
+	e.CheckInterval = time.Hour
+
+	go e.Run(t.Context())
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for e.checked.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the first background check did not run")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_days_left"); n != 1 {
+		t.Fatalf("days_left series = %d, want 1", n)
+	}
+
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/miekg/dns"
+	"go.yaml.in/yaml/v3"
+)
+
+// fileTargets is the content of one file_sd file. It has the records and zones
+// tables of the configuration file, written in YAML or JSON.
+type fileTargets struct {
+	Records []Record `yaml:"records"`
+	Zones   []Zone   `yaml:"zones"`
+}
+
+// fileSD holds the records and zones of one [[file_sd]] entry. It keeps the
+// last good read of every file, so a file that is being rewritten, or has an
+// error, does not drop what it listed before.
+type fileSD struct {
+	patterns []string
+	labels   map[string]string
+
+	// source reports the zones and the success of the reads.
+	source *zoneSource
+
+	mu      sync.Mutex
+	files   map[string]fileTargets
+	records []Record
+}
+
+// readFileSD reads the files of sd again, and returns their zones. A file that
+// cannot be read or fails the checks keeps the records and zones of its last
+// good read, and makes the read fail. A file that was removed is dropped.
+func (e *Exporter) readFileSD(sd *fileSD) ([]Zone, error) {
+	var paths []string
+
+	for _, pattern := range sd.patterns {
+		matches, err := includedFiles(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("files %q: %w", pattern, err)
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	files := make(map[string]fileTargets, len(paths))
+
+	var errs []error
+
+	for _, path := range paths {
+		targets, err := e.readFileTargets(sd, path)
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+
+		case err != nil:
+			errs = append(errs, err)
+
+			last, ok := sd.files[path]
+			if !ok {
+				continue
+			}
+
+			targets = last
+		}
+
+		files[path] = targets
+	}
+
+	sd.files = files
+	sd.records = nil
+
+	var zones []Zone
+
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		sd.records = append(sd.records, files[path].Records...)
+		zones = append(zones, files[path].Zones...)
+	}
+
+	if zones == nil {
+		zones = []Zone{}
+	}
+
+	return zones, errors.Join(errs...)
+}
+
+// readFileTargets reads and checks one file. The records and zones in it get
+// the checks of the [[records]] and [[zones]] entries.
+func (e *Exporter) readFileTargets(sd *fileSD, path string) (fileTargets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileTargets{}, err
+	}
+
+	var targets fileTargets
+
+	// JSON is YAML, so one decoder reads both. An unknown key is an error, as
+	// it is in the configuration file.
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&targets); err != nil && !errors.Is(err, io.EOF) {
+		return fileTargets{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for i := range targets.Records {
+		targets.Records[i].source = path
+		targets.Records[i].Labels = withLabels(targets.Records[i].Labels, sd.labels)
+	}
+
+	for i := range targets.Zones {
+		targets.Zones[i].source = path
+		targets.Zones[i].Labels = withLabels(targets.Zones[i].Labels, sd.labels)
+	}
+
+	records, err := expandRecords(targets.Records)
+	if err != nil {
+		return fileTargets{}, inFile(path, err)
+	}
+
+	targets.Records = records
+
+	seen := make(map[string]bool, len(targets.Records)+len(targets.Zones))
+
+	for _, rec := range targets.Records {
+		if err := e.validateRecord(rec); err != nil {
+			return fileTargets{}, inFile(path, err)
+		}
+
+		if err := e.knownLabels(rec.Labels); err != nil {
+			return fileTargets{}, inFile(path, fmt.Errorf("record %s: %w", rec, err))
+		}
+
+		if seen[rec.String()] {
+			return fileTargets{}, inFile(path, fmt.Errorf("record %s is listed twice, remove the duplicate", rec))
+		}
+
+		seen[rec.String()] = true
+	}
+
+	for _, zone := range targets.Zones {
+		if zone.Zone == "" {
+			return fileTargets{}, inFile(path, errors.New("a zone has no name: give every zone a zone"))
+		}
+
+		if err := e.validateZone(zone); err != nil {
+			return fileTargets{}, inFile(path, err)
+		}
+
+		if err := e.knownLabels(zone.Labels); err != nil {
+			return fileTargets{}, inFile(path, fmt.Errorf("zone %s: %w", zone.Zone, err))
+		}
+
+		if seen[dns.Fqdn(zone.Zone)] {
+			return fileTargets{}, inFile(path, fmt.Errorf("zone %s is listed twice, remove the duplicate", zone.Zone))
+		}
+
+		seen[dns.Fqdn(zone.Zone)] = true
+	}
+
+	return targets, nil
+}
+
+// withLabels returns labels with the labels of the [[file_sd]] entry that it
+// does not set itself.
+func withLabels(labels, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return labels
+	}
+
+	merged := maps.Clone(defaults)
+	maps.Copy(merged, labels)
+
+	return merged
+}
+
+// knownLabels checks that every label is one the metrics already have. The
+// labels of the metrics are set when the configuration file is loaded, and a
+// file cannot change them without a reload.
+func (e *Exporter) knownLabels(labels map[string]string) error {
+	for name := range labels {
+		if !slices.Contains(e.labels, name) {
+			return fmt.Errorf("label %q is not in the configuration file: add it to the labels of the [[file_sd]] entry", name)
+		}
+	}
+
+	return nil
+}
+
+// records returns the records to check in this scrape: the [[records]]
+// entries, followed by the records from the file_sd files. A record that is
+// already checked is left out, so an entry in the configuration file wins.
+func (e *Exporter) records() []Record {
+	if len(e.fileSD) == 0 {
+		return e.Records
+	}
+
+	records := slices.Clone(e.Records)
+	seen := make(map[string]bool, len(e.Records))
+
+	for _, rec := range e.Records {
+		seen[rec.String()] = true
+	}
+
+	for _, sd := range e.fileSD {
+		sd.mu.Lock()
+
+		for _, rec := range sd.records {
+			if seen[rec.String()] {
+				continue
+			}
+
+			seen[rec.String()] = true
+
+			records = append(records, rec)
+		}
+
+		sd.mu.Unlock()
+	}
+
+	return records
+}
+
+// watch makes the next scrape read the files again as soon as one of them
+// changes, until ctx is done. It watches the directories rather than the files,
+// because a file that is replaced by a rename, as most provisioning systems do,
+// would end a watch on the file. Without a watch, the files are still read every
+// refresh interval.
+func (sd *fileSD) watch(ctx context.Context, logger *slog.Logger) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn("cannot watch file_sd files, reading them every refresh", "source", sd.source.name, "error", err)
+		return
+	}
+	// Closing a watcher only releases it, so there is nothing to report.
+	defer func() { _ = watcher.Close() }()
+
+	dirs := make(map[string]bool, len(sd.patterns))
+	for _, pattern := range sd.patterns {
+		dirs[filepath.Dir(pattern)] = true
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			logger.Warn("cannot watch file_sd directory, reading it every refresh", "directory", dir, "error", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if sd.matches(event.Name) {
+				sd.source.invalidate()
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			// An overflow loses events, so any of the files may have changed.
+			logger.Warn("file_sd watch failed", "source", sd.source.name, "error", err)
+			sd.source.invalidate()
+		}
+	}
+}
+
+// matches reports whether path is one of the files of sd.
+func (sd *fileSD) matches(path string) bool {
+	for _, pattern := range sd.patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testTargetsYAML = `
+records:
+  - zone: example.org
+    records: ["@", www]
+    type: A
+    labels:
+      team: web
+zones:
+  - zone: example.com
+    server: 127.0.0.1:53
+    warn_days: 30
+`
+
+const testTargetsJSON = `{
+  "records": [{"zone": "example.net", "record": "@", "type": "SOA"}]
+}`
+
+// testFileSD returns an exporter with a [[file_sd]] entry that reads the YAML
+// and JSON files in dir, and a record of its own.
+func testFileSD(t *testing.T, dir string) *Exporter {
+
+	e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	e.Records = []Record{{Zone: "example.org", Record: "@", Type: "A", Labels: map[string]string{"team": "dns"}}}
+	e.FileSD = []FileSD{{
+		Files:  []string{filepath.Join(dir, "*.yml"), filepath.Join(dir, "*.json")},
+		Labels: map[string]string{"team": "provisioned"},
+	}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	return e
+}
+
+// read reads the files of the first file_sd entry of e again.
+func read(t *testing.T, e *Exporter) ([]Zone, bool) {
+
+	e.fileSD[0].source.invalidate()
+
+	return e.fileSD[0].source.get(t.Context(), e)
+}
+
+func TestFileSDReadsRecordsAndZones(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"web.yml": testTargetsYAML, "dns.json": testTargetsJSON})
+
+	e := testFileSD(t, dir)
+
+	zones, ok := read(t, e)
+	if !ok {
+		t.Fatal("expected the files to be read")
+	}
+
+	if len(zones) != 1 || zones[0].Zone != "example.com" || zones[0].WarnDays != 30 {
+		t.Fatalf("zones = %+v, want example.com with warn_days 30", zones)
+	}
+
+	// The record in the configuration file wins over the one in web.yml.
+	var got []string
+	for _, rec := range e.records() {
+		got = append(got, rec.String()+" "+rec.Labels["team"])
+	}
+
+	want := []string{
+		"@ A in example.org dns",
+		"@ SOA in example.net provisioned",
+		"www A in example.org web",
+	}
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("records = %q, want %q", got, want)
+	}
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_resolves"); n != 3 {
+		t.Fatalf("resolves series = %d, want 3", n)
+	}
+
+}
+
+// A file that is being rewritten, or has a mistake, must not stop the checks it
+// listed before.
+func TestFileSDKeepsLastGoodRead(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"web.yml": testTargetsYAML, "dns.json": testTargetsJSON})
+
+	e := testFileSD(t, dir)
+
+	if _, ok := read(t, e); !ok {
+		t.Fatal("expected the files to be read")
+	}
+
+	writeFiles(t, dir, map[string]string{"web.yml": "records:\n  - zone: example.org\n    record: www\n    type: NOPE\n"})
+
+	zones, ok := read(t, e)
+	if ok {
+		t.Fatal("expected the read of an invalid file to fail")
+	}
+
+	if len(zones) != 1 || len(e.records()) != 3 {
+		t.Fatalf("got %d zones and %d records after a bad read, want 1 and 3", len(zones), len(e.records()))
+	}
+
+}
+
+func TestFileSDErrors(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"unknown key", "records:\n  - zone: example.org\n    recrod: www\n", "field recrod not found"},
+		{"unknown label", "zones:\n  - zone: example.com\n    labels: {owner: me}\n", `label "owner" is not in the configuration file`},
+		{"duplicate", "zones:\n  - zone: example.com\n  - zone: example.com.\n", "listed twice"},
+		{"unknown key of zone", "zones:\n  - zone: example.com\n    key: missing.\n", "which no [[keys]] section defines"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"targets.yml": tt.data})
+
+			e := testFileSD(t, dir)
+
+			_, err := e.readFileSD(e.fileSD[0])
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+}
+
+// A change to a file must be picked up at the next scrape, not after the
+// refresh interval.
+func TestFileSDWatch(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"dns.json": testTargetsJSON})
+
+	e := testFileSD(t, dir)
+	source := e.fileSD[0].source
+
+	if _, ok := source.get(t.Context(), e); !ok {
+		t.Fatal("expected the files to be read")
+	}
+
+	go e.Run(t.Context())
+
+	// The watch is set up in the background, so write until it sees a change.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		writeFiles(t, dir, map[string]string{"web.yml": testTargetsYAML})
+
+		source.mu.Lock()
+		invalidated := source.fetched.IsZero()
+		source.mu.Unlock()
+
+		if invalidated {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the change to the file was not noticed")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if zones, _ := source.get(t.Context(), e); len(zones) != 1 {
+		t.Fatalf("zones after the change = %d, want 1", len(zones))
+	}
+
+}
+
+func TestValidateFileSD(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		entry   FileSD
+		wantErr string
+	}{
+		{name: "valid", entry: FileSD{Files: []string{"/etc/dnssec/targets/*.yml"}}},
+		{name: "no files", entry: FileSD{}, wantErr: "has no files"},
+		{name: "negative refresh", entry: FileSD{Files: []string{"targets.yml"}, Refresh: -time.Minute}, wantErr: "refresh must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+			e.FileSD = []FileSD{tt.entry}
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+
+}
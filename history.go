@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// history remembers, for every record on a resolver and every zone on a
+// server, when a check of it last succeeded and how many checks have failed
+// since. The metrics of a failed check are absent, so without it an outage
+// shows only as a gap. Like the instruments, run hands the same history to
+// every exporter it loads, so a reload does not reset it.
+type history struct {
+	mu      sync.Mutex
+	targets map[string]*outcome
+
+	// round counts the rounds of checks, so a round can forget the targets
+	// that no round since it began has checked.
+	round uint64
+}
+
+// outcome is what the history knows about one target. lastSuccess is zero
+// until a check of the target succeeds. round is the round that checked the
+// target last.
+type outcome struct {
+	lastSuccess time.Time
+	failures    int
+	round       uint64
+}
+
+func newHistory() *history {
+	return &history{targets: make(map[string]*outcome)}
+}
+
+// add records a check of target that finished at now, and returns the outcome
+// of the target after it. A success resets the failures.
+func (h *history) add(target string, success bool, now time.Time) outcome {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o, ok := h.targets[target]
+	if !ok {
+		o = &outcome{}
+		h.targets[target] = o
+	}
+
+	o.round = h.round
+
+	if success {
+		o.lastSuccess = now
+		o.failures = 0
+	} else {
+		o.failures++
+	}
+
+	return *o
+}
+
+// begin starts a round of checks, and returns it for prune.
+func (h *history) begin() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.round++
+
+	return h.round
+}
+
+// prune forgets the targets that no check has added to the history since round
+// began. They are no longer in the configuration, or in a source of zones, and
+// if one comes back it starts over rather than with the failures and the last
+// success of long ago.
+func (h *history) prune(round uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for target, o := range h.targets {
+		if o.round < round {
+			delete(h.targets, target)
+		}
+	}
+}
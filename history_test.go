@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHistoryCountsFailuresSinceSuccess(t *testing.T) {
+
+	h := newHistory()
+	now := time.Unix(2000000000, 0)
+
+	h.add("a", false, now)
+
+	if o := h.add("a", false, now.Add(time.Minute)); o.failures != 2 || !o.lastSuccess.IsZero() {
+		t.Fatalf("after two failures got %+v, want 2 failures and no success", o)
+	}
+
+	if o := h.add("a", true, now.Add(2*time.Minute)); o.failures != 0 || !o.lastSuccess.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("after a success got %+v, want no failures and the time of the success", o)
+	}
+
+	// A failure keeps the time of the last success, which is what tells how
+	// long the target has been failing.
+	if o := h.add("a", false, now.Add(3*time.Minute)); o.failures != 1 || !o.lastSuccess.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("after a failure got %+v, want 1 failure and the time of the success", o)
+	}
+
+	if o := h.add("b", true, now); o.failures != 0 {
+		t.Fatalf("a target must not count the failures of another, got %+v", o)
+	}
+
+}
+
+// The failures must count across scrapes, and across a reload, which hands the
+// history to the exporter it loads.
+func TestFailuresSurviveScrapesAndReloads(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	e.Records = []Record{soaRecord()}
+
+	collectOne(t, e, "dnssec_zone_record_consecutive_failures")
+
+	if got := testutil.ToFloat64(collectOne(t, e, "dnssec_zone_record_consecutive_failures")); got != 2 {
+		t.Fatalf("consecutive_failures after two scrapes = %v, want 2", got)
+	}
+
+	reloaded := NewDNSSECExporter(time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	reloaded.Records = []Record{soaRecord()}
+	reloaded.history = e.history
+
+	if got := testutil.ToFloat64(collectOne(t, reloaded, "dnssec_zone_record_consecutive_failures")); got != 3 {
+		t.Fatalf("consecutive_failures after a reload = %v, want 3", got)
+	}
+
+	if n := testutil.CollectAndCount(reloaded, "dnssec_zone_record_last_success_timestamp_seconds"); n != 0 {
+		t.Fatalf("expected no last_success series for a record that never resolved, got %d", n)
+	}
+
+}
+
+func TestHistoryPrunesTargetsNotChecked(t *testing.T) {
+
+	h := newHistory()
+	now := time.Unix(2000000000, 0)
+
+	h.add("a", true, now)
+	h.add("b", false, now)
+
+	round := h.begin()
+	h.add("a", false, now.Add(time.Minute))
+	h.prune(round)
+
+	if _, ok := h.targets["b"]; ok {
+		t.Fatal("expected the round to forget b, which it did not check")
+	}
+
+	if _, ok := h.targets["a"]; !ok {
+		t.Fatal("expected the round to keep a, which it checked")
+	}
+
+	// A round that began before another round checked a target keeps it.
+	first := h.begin()
+	second := h.begin()
+	h.add("c", false, now)
+	h.prune(first)
+	h.prune(second)
+
+	if _, ok := h.targets["c"]; !ok {
+		t.Fatal("expected the rounds to keep c, which the second checked")
+	}
+
+}
+
+// A record that leaves the configuration and comes back must not resume its
+// old failures, which would fire the alerts on the time it has been failing at
+// once.
+func TestFailuresForgottenWhenRecordLeaves(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	e.Records = []Record{soaRecord()}
+
+	collectOne(t, e, "dnssec_zone_record_consecutive_failures")
+	collectOne(t, e, "dnssec_zone_record_consecutive_failures")
+
+	other := soaRecord()
+	other.Zone = "example.net"
+
+	without := NewDNSSECExporter(time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	without.Records = []Record{other}
+	without.history = e.history
+
+	collectOne(t, without, "dnssec_zone_record_consecutive_failures")
+
+	back := NewDNSSECExporter(time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	back.Records = []Record{soaRecord()}
+	back.history = e.history
+
+	if got := testutil.ToFloat64(collectOne(t, back, "dnssec_zone_record_consecutive_failures")); got != 1 {
+		t.Fatalf("consecutive_failures of a record that came back = %v, want 1", got)
+	}
+
+}
+
+func TestLastSuccessReported(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, addr, nullLogger())
+	e.Records = []Record{soaRecord()}
+
+	before := time.Now()
+
+	got := testutil.ToFloat64(collectOne(t, e, "dnssec_zone_record_last_success_timestamp_seconds"))
+	if got < float64(before.Unix()) {
+		t.Fatalf("last_success = %v, want a time after %v", got, before.Unix())
+	}
+
+	if got := testutil.ToFloat64(collectOne(t, e, "dnssec_zone_record_consecutive_failures")); got != 0 {
+		t.Fatalf("consecutive_failures = %v, want 0", got)
+	}
+
+}
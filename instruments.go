@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// instruments are the metrics about the exporter itself: how long queries and
+// transfers take, and how many fail. They count across reloads, so run creates
+// them once, registers them, and hands them to every exporter it loads. An
+// exporter that is not given them, such as in a test, gets its own, which no
+// registry collects.
+type instruments struct {
+	queryDuration    *prometheus.HistogramVec
+	transferDuration *prometheus.HistogramVec
+	queries          *prometheus.CounterVec
+	queryErrors      *prometheus.CounterVec
+}
+
+func newInstruments() *instruments {
+	return &instruments{
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "dnssec_exporter_query_duration_seconds",
+			Help:    "Duration of the DNS queries to a resolver",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}, []string{"resolver"}),
+		transferDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "dnssec_exporter_transfer_duration_seconds",
+			Help:    "Duration of the zone transfers from a server",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		}, []string{"server"}),
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dnssec_exporter_queries_total",
+			Help: "Number of DNS queries sent to a resolver",
+		}, []string{"resolver"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dnssec_exporter_query_errors_total",
+			Help: "Number of DNS queries to a resolver that failed, by reason",
+		}, []string{"resolver", "reason"}),
+	}
+}
+
+// collectors returns the metrics, for a registry to register.
+func (i *instruments) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		i.queryDuration,
+		i.transferDuration,
+		i.queries,
+		i.queryErrors,
+	}
+}
+
+// queryFailure returns why a query failed, normalized so it can be a label
+// value, or "" when it did not. A response with an error rcode, or that the
+// resolver truncated, is a failure too, because it holds no answer to check.
+func queryFailure(response *dns.Msg, err error) string {
+	if err != nil {
+		return errorReason(err)
+	}
+
+	if response.Truncated {
+		return "truncated"
+	}
+
+	if response.Rcode != dns.RcodeSuccess {
+		return rcodeName(response.Rcode)
+	}
+
+	return ""
+}
+
+// transferFailure returns why a zone transfer failed, normalized like
+// queryFailure.
+func transferFailure(err error) string {
+	// The library reports an error rcode of a transfer only in the text of the
+	// error.
+	var (
+		dnsErr *dns.Error
+		rcode  int
+	)
+
+	if errors.As(err, &dnsErr) {
+		if _, scanErr := fmt.Sscanf(dnsErr.Error(), "dns: bad xfr rcode: %d", &rcode); scanErr == nil {
+			// A server answers a transfer with a key it cannot verify with
+			// NOTAUTH.
+			if rcode == dns.RcodeNotAuth {
+				return "tsig_error"
+			}
+
+			return rcodeName(rcode)
+		}
+	}
+
+	return errorReason(err)
+}
+
+// rcodeName returns an rcode in lower case, such as servfail, so it can be a
+// label value.
+func rcodeName(rcode int) string {
+	if name, ok := dns.RcodeToString[rcode]; ok {
+		return strings.ToLower(name)
+	}
+
+	return "rcode"
+}
+
+// errorReason returns why a query or a transfer could not get a response.
+func errorReason(err error) string {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+
+	case errors.Is(err, dns.ErrSig), errors.Is(err, dns.ErrNoSig), errors.Is(err, dns.ErrSecret),
+		errors.Is(err, dns.ErrTime), errors.Is(err, dns.ErrKeyAlg):
+		return "tsig_error"
+	}
+
+	return "other"
+}
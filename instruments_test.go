@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueryFailure(t *testing.T) {
+
+	response := func(rcode int, truncated bool) *dns.Msg {
+		msg := &dns.Msg{}
+		msg.Rcode = rcode
+		msg.Truncated = truncated
+
+		return msg
+	}
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+
+	tests := []struct {
+		name     string
+		response *dns.Msg
+		err      error
+		want     string
+	}{
+		{"success", response(dns.RcodeSuccess, false), nil, ""},
+		{"servfail", response(dns.RcodeServerFailure, false), nil, "servfail"},
+		{"nxdomain", response(dns.RcodeNameError, false), nil, "nxdomain"},
+		{"refused", response(dns.RcodeRefused, false), nil, "refused"},
+		{"truncated", response(dns.RcodeSuccess, true), nil, "truncated"},
+		{"timeout", nil, fmt.Errorf("exchange: %w", context.DeadlineExceeded), "timeout"},
+		{"connection refused", nil, refused, "connection_refused"},
+		{"tsig", nil, dns.ErrSig, "tsig_error"},
+		{"other", nil, dns.ErrShortRead, "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryFailure(tt.response, tt.err); got != tt.want {
+				t.Fatalf("queryFailure = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestTransferFailure(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"other", fmt.Errorf("read zone: %w", dns.ErrShortRead), "other"},
+		{"no signature", fmt.Errorf("read zone: %w", dns.ErrNoSig), "tsig_error"},
+		{"timeout", fmt.Errorf("read zone: %w", context.DeadlineExceeded), "timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transferFailure(tt.err); got != tt.want {
+				t.Fatalf("transferFailure = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestResolveInstruments(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, []string{addr[0], "127.0.0.1:1"}, nullLogger())
+
+	for _, resolver := range e.resolvers {
+		e.resolve(t.Context(), soaRecord(), resolver)
+	}
+
+	if got := testutil.ToFloat64(e.instruments.queries.WithLabelValues(addr[0])); got != 1 {
+		t.Fatalf("queries to the server = %v, want 1", got)
+	}
+
+	if got := testutil.ToFloat64(e.instruments.queryErrors.WithLabelValues("127.0.0.1:1", "connection_refused")); got != 1 {
+		t.Fatalf("refused queries = %v, want 1", got)
+	}
+
+	// Both queries are timed, the failed one too.
+	if n := testutil.CollectAndCount(e.instruments.queryDuration); n != 2 {
+		t.Fatalf("query duration series = %d, want 2", n)
+	}
+
+	if n := testutil.CollectAndCount(e.instruments.queryErrors); n != 1 {
+		t.Fatalf("query error series = %d, want 1", n)
+	}
+
+}
+
+func TestTransferDuration(t *testing.T) {
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{time.Unix(2000000000, 0)},
+	})
+
+	defer cancel()
+
+	e := zoneExporter(t, Zone{Zone: "example.com", Server: addr}, nil)
+
+	// Two zones from one server make one series, so a zone that leaves the
+	// configuration leaves no series behind.
+	for _, zone := range []string{"example.com", "example.net"} {
+		if _, err := e.transfer(t.Context(), Zone{Zone: zone}, addr); err != nil && zone == "example.com" {
+			t.Fatalf("expected the transfer to succeed, got: %v", err)
+		}
+	}
+
+	if n := testutil.CollectAndCount(e.instruments.transferDuration); n != 1 {
+		t.Fatalf("transfer duration series = %d, want 1", n)
+	}
+
+}
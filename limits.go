@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// queryLimits bounds the queries and zone transfers the exporter has in
+// flight: all of them, and those to each resolver. A check waits for its turn
+// rather than fail, so a large configuration takes longer instead of flapping
+// when a resolver rate limits it. The limits and the counts are by address,
+// because the address is what a server rate limits: a zone transfer from the
+// address of a resolver counts against the limits of the resolver.
+type queryLimits struct {
+	// global holds a slot for every query in flight, or is nil without a
+	// limit.
+	global chan struct{}
+
+	// resolvers holds the limits of the resolvers that have any, by address.
+	resolvers map[string]*resolverLimit
+
+	mu     sync.Mutex
+	counts map[string]*queryCount
+}
+
+// resolverLimit is the limit of one resolver. slots is nil without a limit on
+// the queries in flight, and rate is nil without a limit on the queries a
+// second.
+type resolverLimit struct {
+	slots chan struct{}
+	rate  *rate.Limiter
+}
+
+// queryCount is the number of queries to a resolver or a server that wait for
+// a limit, and that are in flight.
+type queryCount struct {
+	queued   int
+	inFlight int
+}
+
+// newQueryLimits returns the limits for maxQueries in flight, or no limit when
+// maxQueries is 0, and the limits of every resolver.
+func newQueryLimits(maxQueries int, resolvers []Resolver) *queryLimits {
+	l := &queryLimits{
+		resolvers: make(map[string]*resolverLimit),
+		counts:    make(map[string]*queryCount, len(resolvers)),
+	}
+
+	if maxQueries > 0 {
+		l.global = make(chan struct{}, maxQueries)
+	}
+
+	for _, res := range resolvers {
+		// A resolver reports 0 queued and in flight before its first query.
+		l.counts[res.Address] = &queryCount{}
+
+		var limit resolverLimit
+
+		if res.MaxConcurrency > 0 {
+			limit.slots = make(chan struct{}, res.MaxConcurrency)
+		}
+
+		if res.QPS > 0 {
+			limit.rate = rate.NewLimiter(rate.Limit(res.QPS), 1)
+		}
+
+		if limit.slots != nil || limit.rate != nil {
+			l.resolvers[res.Address] = &limit
+		}
+	}
+
+	return l
+}
+
+// share returns limits that take their slots from those of l, so the queries
+// under either count against the same limits, but that count the queries that
+// wait and that are in flight apart from l.
+func (l *queryLimits) share() *queryLimits {
+	return &queryLimits{
+		global:    l.global,
+		resolvers: l.resolvers,
+		counts:    make(map[string]*queryCount),
+	}
+}
+
+// limited reports whether any limit is set.
+func (l *queryLimits) limited() bool {
+	return l.global != nil || len(l.resolvers) > 0
+}
+
+// acquire waits until a query to target, the address of a resolver or a
+// server, is within the limits. The caller must call the returned function when
+// the query is done. acquire fails only when ctx is done first.
+func (l *queryLimits) acquire(ctx context.Context, target string) (func(), error) {
+	count := l.count(target)
+
+	l.update(func() { count.queued++ })
+
+	var held []chan struct{}
+
+	release := func() {
+		for _, slots := range held {
+			<-slots
+		}
+	}
+
+	// The resolver slot comes before the global one, so a query that waits for
+	// a busy resolver does not hold a global slot that another resolver could
+	// use.
+	limit := l.resolvers[target]
+
+	var err error
+
+	if limit != nil && limit.slots != nil {
+		err = take(ctx, limit.slots, &held)
+	}
+
+	if err == nil && limit != nil && limit.rate != nil {
+		err = limit.rate.Wait(ctx)
+
+		// Wait fails at once, with an error of its own, when the turn of the
+		// query comes after the deadline of ctx. That is a timeout all the same.
+		if err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+		}
+	}
+
+	if err == nil && l.global != nil {
+		err = take(ctx, l.global, &held)
+	}
+
+	if err != nil {
+		release()
+		l.update(func() { count.queued-- })
+
+		return nil, err
+	}
+
+	l.update(func() {
+		count.queued--
+		count.inFlight++
+	})
+
+	return func() {
+		release()
+		l.update(func() { count.inFlight-- })
+	}, nil
+}
+
+// take waits for a free slot in slots, and adds it to held.
+func take(ctx context.Context, slots chan struct{}, held *[]chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		*held = append(*held, slots)
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// count returns the count of target, which starts at zero.
+func (l *queryLimits) count(target string) *queryCount {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count, ok := l.counts[target]
+	if !ok {
+		count = &queryCount{}
+		l.counts[target] = count
+	}
+
+	return count
+}
+
+func (l *queryLimits) update(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fn()
+}
+
+// snapshot returns the targets in order, with a copy of their counts.
+func (l *queryLimits) snapshot() ([]string, []queryCount) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	targets := make([]string, 0, len(l.counts))
+	for target := range l.counts {
+		targets = append(targets, target)
+	}
+
+	slices.Sort(targets)
+
+	counts := make([]queryCount, 0, len(targets))
+	for _, target := range targets {
+		counts = append(counts, *l.counts[target])
+	}
+
+	return targets, counts
+}
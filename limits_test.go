@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// counts returns the queued and in flight count of target.
+func counts(l *queryLimits, target string) queryCount {
+
+	targets, counts := l.snapshot()
+	for i, t := range targets {
+		if t == target {
+			return counts[i]
+		}
+	}
+
+	return queryCount{}
+}
+
+func TestGlobalLimitQueues(t *testing.T) {
+
+	l := newQueryLimits(1, nil)
+
+	done, err := l.acquire(t.Context(), "a")
+	if err != nil {
+		t.Fatalf("expected the first query to start, got: %v", err)
+	}
+
+	started := make(chan func())
+
+	go func() {
+		second, err := l.acquire(context.Background(), "b")
+		if err != nil {
+			t.Errorf("expected the second query to start, got: %v", err)
+		}
+
+		started <- second
+	}()
+
+	// The second query waits for the first, to another target.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for counts(l, "b").queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the second query was not queued")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-started:
+		t.Fatal("the second query started while the first was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	done()
+
+	second := <-started
+
+	if got := counts(l, "b"); got != (queryCount{inFlight: 1}) {
+		t.Fatalf("counts of b = %+v, want 1 in flight", got)
+	}
+
+	second()
+
+	if got := counts(l, "b"); got != (queryCount{}) {
+		t.Fatalf("counts of b after the query = %+v, want none", got)
+	}
+
+}
+
+// A check that runs out of time while it waits must give up its place, or the
+// queue would never drain.
+func TestResolverLimitGivesUpWithContext(t *testing.T) {
+
+	l := newQueryLimits(0, []Resolver{{Name: "google", Address: "8.8.8.8:53", MaxConcurrency: 1}})
+
+	done, err := l.acquire(t.Context(), "8.8.8.8:53")
+	if err != nil {
+		t.Fatalf("expected the first query to start, got: %v", err)
+	}
+	defer done()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.acquire(ctx, "8.8.8.8:53"); err == nil {
+		t.Fatal("expected the second query to time out while it waits")
+	}
+
+	if got := counts(l, "8.8.8.8:53"); got != (queryCount{inFlight: 1}) {
+		t.Fatalf("counts = %+v, want 1 in flight and none queued", got)
+	}
+
+	// Another resolver is not limited by google.
+	other, err := l.acquire(ctx, "1.1.1.1:53")
+	if err != nil {
+		t.Fatalf("expected a query to another resolver to start, got: %v", err)
+	}
+
+	other()
+
+}
+
+func TestResolverQPS(t *testing.T) {
+
+	l := newQueryLimits(0, []Resolver{{Name: "google", Address: "8.8.8.8:53", QPS: 50}})
+
+	start := time.Now()
+
+	for range 4 {
+		done, err := l.acquire(t.Context(), "8.8.8.8:53")
+		if err != nil {
+			t.Fatalf("expected the query to start, got: %v", err)
+		}
+
+		done()
+	}
+
+	// The first query starts at once, and each of the other three waits 20ms.
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("4 queries at 50 a second took %v", elapsed)
+	}
+
+}
+
+// A query that the rate limit holds past its deadline is a timeout, not an
+// error of another kind.
+func TestResolverQPSTimesOut(t *testing.T) {
+
+	l := newQueryLimits(0, []Resolver{{Name: "google", Address: "8.8.8.8:53", QPS: 1}})
+
+	done, err := l.acquire(t.Context(), "8.8.8.8:53")
+	if err != nil {
+		t.Fatalf("expected the first query to start, got: %v", err)
+	}
+
+	done()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = l.acquire(ctx, "8.8.8.8:53")
+	if err == nil {
+		t.Fatal("expected the second query to time out while it waits")
+	}
+
+	if reason := errorReason(err); reason != "timeout" {
+		t.Fatalf("errorReason(%v) = %q, want timeout", err, reason)
+	}
+
+	if got := counts(l, "8.8.8.8:53"); got != (queryCount{}) {
+		t.Fatalf("counts = %+v, want none queued or in flight", got)
+	}
+
+}
+
+func TestCollectWithLimits(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{})
+	defer cancel()
+
+	e := NewDNSSECExporter(2*time.Second, addr, nullLogger())
+	e.Records = []Record{
+		{Zone: "example.org", Record: "@", Type: "SOA"},
+		{Zone: "example.org", Record: "www", Type: "SOA"},
+		{Zone: "example.org", Record: "mail", Type: "SOA"},
+	}
+	e.MaxConcurrency = 1
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_days_left"); n != 3 {
+		t.Fatalf("days_left series = %d, want 3", n)
+	}
+
+	expected := `
+# HELP dnssec_exporter_queries_in_flight Number of queries and zone transfers in flight
+# TYPE dnssec_exporter_queries_in_flight gauge
+dnssec_exporter_queries_in_flight{resolver="` + addr[0] + `"} 0
+# HELP dnssec_exporter_queries_queued Number of queries and zone transfers that wait for a concurrency or rate limit
+# TYPE dnssec_exporter_queries_queued gauge
+dnssec_exporter_queries_queued{resolver="` + addr[0] + `"} 0
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"dnssec_exporter_queries_in_flight", "dnssec_exporter_queries_queued"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+// A query that waits for its turn must still have the whole timeout once it is
+// sent, or a large configuration under a rate limit turns into timeouts.
+func TestQueueDoesNotUseUpTimeout(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{})
+	defer cancel()
+
+	// 30 queries at 100 a second take 300ms, three times the timeout.
+	e := NewDNSSECExporter(100*time.Millisecond, nil, nullLogger())
+	e.Resolvers = []Resolver{{Name: "local", Address: addr[0], QPS: 100}}
+
+	for i := range 30 {
+		e.Records = append(e.Records, Record{Zone: "example.org", Record: fmt.Sprintf("r%d", i), Type: "SOA"})
+	}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_query_error"); n != 0 {
+		t.Fatalf("query_error series at scrape time = %d, want 0", n)
+	}
+
+	e.CheckInterval = time.Hour
+	e.checkOnce(t.Context())
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_query_error"); n != 0 {
+		t.Fatalf("query_error series of a background check = %d, want 0", n)
+	}
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_days_left"); n != 30 {
+		t.Fatalf("days_left series = %d, want 30", n)
+	}
+
+}
+
+// A zone transfer from the address of a limited resolver must wait for the
+// limits of the resolver, which knows nothing of names.
+func TestTransferSharesResolverLimits(t *testing.T) {
+
+	e := NewDNSSECExporter(time.Second, nil, nullLogger())
+	e.Resolvers = []Resolver{{Name: "google", Address: "8.8.8.8", MaxConcurrency: 1}}
+	e.Zones = []Zone{{Zone: "example.com"}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	done, err := e.limits.acquire(t.Context(), e.resolvers[0].Address)
+	if err != nil {
+		t.Fatalf("expected the query to start, got: %v", err)
+	}
+	defer done()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := e.transfer(ctx, e.Zones[0], e.zoneServer(e.Zones[0])); err == nil || !strings.Contains(err.Error(), "wait for the query limits") {
+		t.Fatalf("expected the transfer to wait for the limit of google, got: %v", err)
+	}
+
+}
+
+func TestValidateLimits(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		max       int
+		resolvers []Resolver
+		wantErr   string
+	}{
+		{name: "valid", max: 100, resolvers: []Resolver{{Address: "8.8.8.8", MaxConcurrency: 10, QPS: 0.5}}},
+		{name: "negative max_concurrency", max: -1, resolvers: []Resolver{{Address: "8.8.8.8"}}, wantErr: "max_concurrency must be positive"},
+		{name: "negative resolver qps", resolvers: []Resolver{{Address: "8.8.8.8", QPS: -1}}, wantErr: "max_concurrency and qps must be positive"},
+		{
+			name: "same limits for the address",
+			resolvers: []Resolver{
+				{Name: "quad9", Address: "9.9.9.9", QPS: 5},
+				{Name: "quad9-udp", Address: "9.9.9.9", Transport: "udp", QPS: 5},
+			},
+		},
+		{
+			name: "other limits for the address",
+			resolvers: []Resolver{
+				{Name: "quad9", Address: "9.9.9.9", QPS: 5},
+				{Name: "quad9-udp", Address: "9.9.9.9", Transport: "udp"},
+			},
+			wantErr: "resolvers quad9 and quad9-udp have the address 9.9.9.9:53 but other limits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, nil, nullLogger())
+			e.Records = []Record{soaRecord()}
+			e.Resolvers = tt.resolvers
+			e.MaxConcurrency = tt.max
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+
+}
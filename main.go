@@ -30,6 +30,8 @@ func run(ctx context.Context, logger *slog.Logger) error {
 	conf := flag.String("config", "/etc/dnssec-checks", "Configuration file")
 	resolvers := flag.String("resolvers", "8.8.8.8:53,1.1.1.1:53", "Resolvers to use (comma separated)")
 	timeout := flag.Duration("timeout", 10*time.Second, "Timeout for network operations")
+	check := flag.Bool("check-config", false, "Check the configuration file, print the checks it configures and exit")
+	lookup := flag.Bool("lookup-addresses", false, "With -check-config, also look up the address of every resolver and zone server")
 
 	flag.Parse()
 
@@ -38,22 +40,54 @@ func run(ctx context.Context, logger *slog.Logger) error {
 		return err
 	}
 
-	exporter, err := loadExporter(*conf, *timeout, r, logger)
+	// The instruments and the history outlive a reload, so every exporter adds
+	// to the same.
+	instruments := newInstruments()
+	history := newHistory()
+
+	load := func() (*Exporter, error) {
+		exporter, err := loadExporter(*conf, *timeout, r, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		exporter.instruments = instruments
+		exporter.history = history
+
+		return exporter, nil
+	}
+
+	exporter, err := load()
 	if err != nil {
 		return err
 	}
 
+	if *check {
+		return checkConfig(ctx, os.Stdout, exporter, *lookup)
+	}
+
+	reloader := newReloader(ctx, exporter, load, logger)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	go reloader.reloadOnSignal(ctx, hup)
+
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(
-		exporter,
+		reloader,
 		collectors.NewGoCollector(),
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
+	registry.MustRegister(instruments.collectors()...)
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
 		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}))
+	mux.Handle("/-/reload", reloader)
+	mux.Handle("/probe", probeHandler(reloader.Exporter))
 
 	srv := &http.Server{
 		Addr:              *addr,
@@ -65,7 +99,7 @@ func run(ctx context.Context, logger *slog.Logger) error {
 	serveErr := make(chan error, 1)
 
 	go func() {
-		logger.Info("listening", "address", *addr, "records", len(exporter.Records), "resolvers", r)
+		logger.Info("listening", "address", *addr, "records", len(exporter.Records), "resolvers", len(exporter.resolvers))
 		serveErr <- srv.ListenAndServe()
 	}()
 
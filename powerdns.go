@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// maxPowerDNSResponse bounds the zone list the exporter reads from the API. A
+// zone takes a few hundred bytes, so this is room for tens of thousands.
+const maxPowerDNSResponse = 64 << 20
+
+// powerDNSZone is the part of a zone in the PowerDNS API that the exporter uses.
+type powerDNSZone struct {
+	Name   string `json:"name"`
+	DNSSEC bool   `json:"dnssec"`
+}
+
+// loadAPIKeys fills in the API key of every [[powerdns]] entry that reads it
+// from a file or an environment variable, like loadSecrets does for keys.
+func loadAPIKeys(entries []PowerDNS) ([]PowerDNS, error) {
+	loaded := make([]PowerDNS, 0, len(entries))
+
+	for _, p := range entries {
+		set := 0
+
+		for _, value := range []string{p.APIKey, p.APIKeyFile, p.APIKeyEnv} {
+			if value != "" {
+				set++
+			}
+		}
+
+		if set > 1 {
+			return nil, inFile(p.source, fmt.Errorf("powerdns %s sets more than one of api_key, api_key_file and api_key_env, set only one", p.URL))
+		}
+
+		var err error
+
+		switch {
+		case p.APIKeyFile != "":
+			p.APIKey, err = secretFromFile(p.source, p.APIKeyFile, "api_key_file")
+		case p.APIKeyEnv != "":
+			p.APIKey, err = secretFromEnv(p.APIKeyEnv, "api_key_env")
+		}
+
+		if err != nil {
+			return nil, inFile(p.source, fmt.Errorf("powerdns %s: %w", p.URL, err))
+		}
+
+		loaded = append(loaded, p)
+	}
+
+	return loaded, nil
+}
+
+// powerDNSZones lists the zones at endpoint, the zones of one server in the
+// PowerDNS API, and returns a zone for every zone that has DNSSEC. An unsigned
+// zone has no signature to check.
+func (e *Exporter) powerDNSZones(ctx context.Context, p PowerDNS, endpoint string) ([]Zone, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	req.Header.Set("X-API-Key", p.APIKey)
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: e.timeout}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list zones: %w", err)
+	}
+	// The body is only read, so a failure to close it cannot lose data.
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list zones: %s", resp.Status)
+	}
+
+	var listed []powerDNSZone
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPowerDNSResponse)).Decode(&listed); err != nil {
+		return nil, fmt.Errorf("read zone list: %w", err)
+	}
+
+	var zones []Zone
+
+	for _, zone := range listed {
+		if zone.DNSSEC && zone.Name != "" {
+			zones = append(zones, p.zone(zoneLabel(zone.Name)))
+		}
+	}
+
+	return zones, nil
+}
+
+// hostPort returns the host:port address that u connects to, with the default
+// port of its scheme when it has none.
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testAPIKey = "changeme"
+
+// runPowerDNS serves a stand-in for the zone list of the PowerDNS API. It
+// answers 401 to a request without the right API key, like PowerDNS does.
+func runPowerDNS(t *testing.T) *httptest.Server {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Header.Get("X-API-Key") != testAPIKey {
+			http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/api/v1/servers/localhost/zones" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, _ = w.Write([]byte(`[
+			{"id": "example.com.", "name": "example.com.", "kind": "Native", "dnssec": true, "serial": 1},
+			{"id": "unsigned.example.", "name": "unsigned.example.", "kind": "Native", "dnssec": false, "serial": 1}
+		]`))
+
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestPowerDNSZonesAreMonitored(t *testing.T) {
+
+	api := runPowerDNS(t)
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{time.Unix(2000000000, 0)},
+	})
+
+	defer cancel()
+
+	e := NewDNSSECExporter(2*time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	e.PowerDNS = []PowerDNS{{URL: api.URL, APIKey: testAPIKey, Server: addr}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	// The unsigned zone has no signature to check, so it is left out.
+	expected := `
+# HELP dnssec_discovery_zones Number of zones that the source lists
+# TYPE dnssec_discovery_zones gauge
+dnssec_discovery_zones{discovery="powerdns",source="` + api.URL + `/api/v1/servers/localhost"} 1
+# HELP dnssec_zone_transfer_success Did the zone transfer from the configured server succeed
+# TYPE dnssec_zone_transfer_success gauge
+dnssec_zone_transfer_success{server="` + addr + `",zone="example.com"} 1
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"dnssec_discovery_zones", "dnssec_zone_transfer_success"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+func TestPowerDNSWrongAPIKey(t *testing.T) {
+
+	api := runPowerDNS(t)
+
+	e := NewDNSSECExporter(2*time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	e.PowerDNS = []PowerDNS{{URL: api.URL, APIKey: "wrong"}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	_, err := e.powerDNSZones(t.Context(), e.PowerDNS[0], api.URL+"/api/v1/servers/localhost/zones")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected an error with the status, got: %v", err)
+	}
+
+	if strings.Contains(err.Error(), "wrong") {
+		t.Fatalf("the error contains the API key: %v", err)
+	}
+
+	expected := `
+# HELP dnssec_discovery_success Did the last attempt to read the zones from the source succeed
+# TYPE dnssec_discovery_success gauge
+dnssec_discovery_success{discovery="powerdns",source="` + api.URL + `/api/v1/servers/localhost"} 0
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "dnssec_discovery_success"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+func TestValidatePowerDNS(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		entry   PowerDNS
+		wantErr string
+	}{
+		{name: "valid", entry: PowerDNS{URL: "http://127.0.0.1:8081", APIKey: testAPIKey}},
+		{name: "no url", entry: PowerDNS{APIKey: testAPIKey}, wantErr: "has no url"},
+		{name: "not http", entry: PowerDNS{URL: "127.0.0.1:8081", APIKey: testAPIKey}, wantErr: "must be an http or https URL"},
+		{name: "no API key", entry: PowerDNS{URL: "http://127.0.0.1:8081"}, wantErr: "has no API key"},
+		{name: "unknown key", entry: PowerDNS{URL: "http://127.0.0.1:8081", APIKey: testAPIKey, Key: "missing."}, wantErr: "which no [[keys]] section defines"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+			e.PowerDNS = []PowerDNS{tt.entry}
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+
+}
+
+// The API key is a credential like the secret of a key, and must not reach the
+// logs or an error message.
+func TestPowerDNSRedactsAPIKey(t *testing.T) {
+
+	p := PowerDNS{URL: "http://127.0.0.1:8081", ServerID: "localhost", APIKey: "s3cret"}
+
+	var logs strings.Builder
+
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("reading zones", "powerdns", p)
+
+	for _, s := range []string{logs.String(), fmt.Sprint(p), fmt.Sprintf("%+v", p)} {
+		if strings.Contains(s, "s3cret") {
+			t.Fatalf("the API key leaked: %s", s)
+		}
+	}
+
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+
+	t.Setenv("DNSSEC_TEST_API_KEY", testAPIKey)
+
+	loaded, err := loadAPIKeys([]PowerDNS{{URL: "http://127.0.0.1:8081", APIKeyEnv: "DNSSEC_TEST_API_KEY"}})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if loaded[0].APIKey != testAPIKey {
+		t.Fatal("the API key was not read from the environment")
+	}
+
+	_, err = loadAPIKeys([]PowerDNS{{URL: "http://127.0.0.1:8081", APIKey: testAPIKey, APIKeyEnv: "DNSSEC_TEST_API_KEY"}})
+	if err == nil || !strings.Contains(err.Error(), "set only one") {
+		t.Fatalf("expected an error about two API keys, got: %v", err)
+	}
+
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// defaultModule is the module of a probe that names none. It resolves the
+// record on the resolvers of the exporter.
+var defaultModule = Module{Name: "default", Prober: "resolve"}
+
+// probeHandler serves /probe with the modules of the configuration in use, so
+// a reload changes them like it changes the checks.
+func probeHandler(current func() *Exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		current().serveProbe(w, req)
+	})
+}
+
+// serveProbe checks the target that the request names, and serves the metrics
+// of that check alone. It builds an exporter for the target, so a probe reports
+// the same metrics as a check in the configuration file.
+func (e *Exporter) serveProbe(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+
+	module := defaultModule
+
+	if name := params.Get("module"); name != "" && name != defaultModule.Name {
+		m, ok := e.modules[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %q", name), http.StatusBadRequest)
+			return
+		}
+
+		module = m
+	}
+
+	probe, err := e.probeExporter(module, params.Get("zone"), params.Get("record"), params.Get("type"), params.Get("resolver"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&probeCollector{probe: probe, ctx: req.Context()})
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, req)
+}
+
+// probeDuration is the one metric of a probe that no check reports.
+var probeDuration = prometheus.NewDesc(
+	"dnssec_probe_duration_seconds",
+	"How long the probe took",
+	nil,
+	nil,
+)
+
+// probeCollector runs a probe when it is collected, and reports how long the
+// probe took after its metrics. The probe stops waiting for the query limits
+// when ctx, the context of the request, is done.
+type probeCollector struct {
+	probe *Exporter
+	ctx   context.Context
+}
+
+func (c *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.probe.Describe(ch)
+	ch <- probeDuration
+}
+
+func (c *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+
+	c.probe.collectQueries(ch)
+	c.probe.check(c.ctx, ch)
+
+	ch <- prometheus.MustNewConstMetric(probeDuration, prometheus.GaugeValue, time.Since(start).Seconds())
+}
+
+// probeExporter returns an exporter that checks one target the way module
+// says: the record on the resolvers, or the transfer of the zone from the
+// server.
+func (e *Exporter) probeExporter(module Module, zone, record, recordType, resolver string) (*Exporter, error) {
+	if zone == "" {
+		return nil, errors.New("zone is required")
+	}
+
+	timeout := module.Timeout
+	if timeout == 0 {
+		timeout = e.timeout
+	}
+
+	addresses := module.Resolvers
+	if resolver != "" {
+		if module.Key != "" {
+			return nil, fmt.Errorf("module %s signs its transfers with a key, so a probe cannot name the resolver", module.Name)
+		}
+
+		addresses = []string{resolver}
+	}
+
+	probe := NewDNSSECExporter(timeout, nil, e.logger)
+	probe.Keys = e.Keys
+	probe.WarnDays = e.WarnDays
+	probe.CriticalDays = e.CriticalDays
+
+	if len(addresses) == 0 {
+		probe.resolvers = e.resolvers
+	}
+
+	for _, address := range addresses {
+		probe.Resolvers = append(probe.Resolvers, Resolver{Address: address, Transport: module.Transport})
+	}
+
+	switch module.Prober {
+	case "transfer":
+		var server string
+		if len(addresses) > 0 {
+			server = addresses[0]
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(server, defaultDNSPort)
+			}
+		}
+
+		probe.Zones = []Zone{{Zone: zone, Server: server, Key: module.Key}}
+
+	default:
+		if record == "" {
+			record = "@"
+		}
+
+		if recordType == "" {
+			recordType = "SOA"
+		}
+
+		probe.Records = []Record{{Zone: zone, Record: record, Type: recordType}}
+	}
+
+	if err := probe.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The queries of a probe count against the limits of the exporter.
+	probe.limits = e.limits.share()
+
+	return probe, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// probe serves a probe with the query in params from the exporter e.
+func probe(t *testing.T, e *Exporter, params url.Values) *httptest.ResponseRecorder {
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/probe?"+params.Encode(), nil)
+
+	probeHandler(func() *Exporter { return e }).ServeHTTP(rec, req)
+
+	return rec
+}
+
+// probingExporter returns a valid exporter with modules and no checks of its
+// own, like one that only serves /probe.
+func probingExporter(t *testing.T, modules ...Module) *Exporter {
+
+	e := NewDNSSECExporter(2*time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	e.Modules = modules
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	return e
+}
+
+func TestProbeResolve(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{expires: time.Unix(2000000000, 0)})
+	defer cancel()
+
+	e := probingExporter(t, Module{Name: "dnssec"})
+
+	rec := probe(t, e, url.Values{"module": {"dnssec"}, "zone": {"example.org"}, "resolver": {addr[0]}})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`dnssec_zone_record_earliest_rrsig_expiry{record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 2e+09`,
+		"dnssec_probe_duration_seconds ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("the probe did not report %q:\n%s", want, body)
+		}
+	}
+
+	// The probe checks the target alone, not the resolvers of the exporter.
+	if strings.Contains(body, "127.0.0.1:1") {
+		t.Fatalf("the probe used the resolvers of the exporter:\n%s", body)
+	}
+
+}
+
+func TestProbeTransfer(t *testing.T) {
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{time.Unix(2000000000, 0)},
+	})
+
+	defer cancel()
+
+	e := probingExporter(t, Module{Name: "axfr", Prober: "transfer"})
+
+	rec := probe(t, e, url.Values{"module": {"axfr"}, "zone": {"example.com"}, "resolver": {addr}})
+
+	want := `dnssec_zone_transfer_success{server="` + addr + `",zone="example.com"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("the probe did not report %q:\n%s", want, rec.Body)
+	}
+
+}
+
+func TestProbeBadRequest(t *testing.T) {
+
+	e := probingExporter(t, Module{Name: "dnssec"})
+
+	tests := []struct {
+		name    string
+		params  url.Values
+		wantErr string
+	}{
+		{"no zone", url.Values{}, "zone is required"},
+		{"unknown module", url.Values{"zone": {"example.org"}, "module": {"nope"}}, `unknown module "nope"`},
+		{"unknown type", url.Values{"zone": {"example.org"}, "type": {"NOPE"}}, `unknown type "NOPE"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := probe(t, e, tt.params)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Fatalf("expected an error that contains %q, got: %s", tt.wantErr, rec.Body)
+			}
+		})
+	}
+
+}
+
+// A probe must not send the signed transfer requests of a module to a server
+// that the request picks, where they could be replayed against the primary.
+func TestProbeKeyRefusesResolver(t *testing.T) {
+
+	e := NewDNSSECExporter(2*time.Second, []string{"127.0.0.1:1"}, nullLogger())
+	e.Keys = []Key{{Name: "k.", Algorithm: "hmac-sha256", Secret: testSecret}}
+	e.Modules = []Module{{Name: "axfr", Prober: "transfer", Resolvers: []string{"192.0.2.53"}, Key: "k."}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	rec := probe(t, e, url.Values{"module": {"axfr"}, "zone": {"example.com"}, "resolver": {"198.51.100.1"}})
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "cannot name the resolver") {
+		t.Fatalf("status = %d, want 400 that refuses the resolver: %s", rec.Code, rec.Body)
+	}
+
+}
+
+// The queries of a probe take their slots from the limits of the exporter, so
+// probes cannot get past max_concurrency.
+func TestProbeSharesLimits(t *testing.T) {
+
+	e := probingExporter(t, Module{Name: "dnssec"})
+	e.limits = newQueryLimits(1, nil)
+
+	done, err := e.limits.acquire(t.Context(), "busy")
+	if err != nil {
+		t.Fatalf("expected the first query to start, got: %v", err)
+	}
+	defer done()
+
+	p, err := e.probeExporter(e.modules["dnssec"], "example.org", "", "", "127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("expected a probe, got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.limits.acquire(ctx, "127.0.0.1:1"); err == nil {
+		t.Fatal("expected the query of the probe to wait for the query of the exporter")
+	}
+
+	// The probe counts its queries apart, so its targets do not show up in the
+	// metrics of the exporter.
+	if targets, _ := e.limits.snapshot(); len(targets) != 1 {
+		t.Fatalf("the exporter counts %v, want only busy", targets)
+	}
+
+}
+
+// The limits of a resolver are on its address, so a probe that names the
+// address of a limited resolver waits for its limits like a check does, and
+// gives up when the request does.
+func TestProbeWaitsForResolverLimits(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{})
+	defer cancel()
+
+	e := NewDNSSECExporter(2*time.Second, nil, nullLogger())
+	e.Resolvers = []Resolver{{Name: "google", Address: addr[0], MaxConcurrency: 1}}
+	e.Modules = []Module{{Name: "dnssec"}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	done, err := e.limits.acquire(t.Context(), addr[0])
+	if err != nil {
+		t.Fatalf("expected the query to start, got: %v", err)
+	}
+
+	params := url.Values{"module": {"dnssec"}, "zone": {"example.org"}, "resolver": {addr[0]}}
+
+	ctx, cancelRequest := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancelRequest()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/probe?"+params.Encode(), nil)
+
+	probeHandler(func() *Exporter { return e }).ServeHTTP(rec, req)
+
+	want := `dnssec_zone_record_query_error{reason="timeout",record="@",resolver="` + addr[0] + `",type="SOA",zone="example.org"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("expected the probe to time out waiting for google, got:\n%s", rec.Body)
+	}
+
+	done()
+
+	rec = probe(t, e, params)
+
+	if !strings.Contains(rec.Body.String(), "dnssec_zone_record_earliest_rrsig_expiry{") {
+		t.Fatalf("expected the probe to resolve once google is free, got:\n%s", rec.Body)
+	}
+
+}
+
+func TestValidateModules(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		modules []Module
+		wantErr string
+	}{
+		{name: "valid", modules: []Module{{Name: "udp", Transport: "udp", Timeout: time.Second}, {Name: "axfr", Prober: "transfer"}}},
+		{name: "no name", modules: []Module{{}}, wantErr: "a module has no name"},
+		{name: "duplicate", modules: []Module{{Name: "a"}, {Name: "a"}}, wantErr: "module a is configured more than once"},
+		{name: "unknown prober", modules: []Module{{Name: "a", Prober: "ping"}}, wantErr: `unknown prober "ping"`},
+		{name: "unknown transport", modules: []Module{{Name: "a", Transport: "quic"}}, wantErr: `unknown transport "quic"`},
+		{name: "unknown key", modules: []Module{{Name: "a", Key: "missing."}}, wantErr: "which no [[keys]] section defines"},
+		{
+			name:    "key without resolvers",
+			modules: []Module{{Name: "a", Prober: "transfer", Key: "k."}},
+			wantErr: "module a uses a key, so it must list the resolvers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+			e.Keys = []Key{{Name: "k.", Algorithm: "hmac-sha256", Secret: testSecret}}
+			e.Modules = tt.modules
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+
+}
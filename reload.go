@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reloader serves the exporter built from the current configuration file and
+// replaces it when the file is reloaded. A scrape that is in progress keeps the
+// exporter it started with, so a reload never interrupts it.
+type reloader struct {
+	load    func() (*Exporter, error)
+	current atomic.Pointer[Exporter]
+
+	// ctx bounds the Run of every exporter, and stop ends the Run of the
+	// current one when a reload replaces it.
+	ctx  context.Context
+	stop context.CancelFunc
+
+	// mu serialises reloads, so two that overlap cannot swap in the older file
+	// last.
+	mu sync.Mutex
+
+	successful  prometheus.Gauge
+	successTime prometheus.Gauge
+
+	logger *slog.Logger
+}
+
+var _ prometheus.Collector = (*reloader)(nil)
+
+// newReloader serves exporter until the first reload, which calls load to read
+// the configuration file again. The exporter in use runs until ctx is done.
+func newReloader(ctx context.Context, exporter *Exporter, load func() (*Exporter, error), logger *slog.Logger) *reloader {
+	r := &reloader{
+		load: load,
+		ctx:  ctx,
+		successful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dnssec_exporter_config_last_reload_successful",
+			Help: "Whether the last configuration reload attempt was successful",
+		}),
+		successTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dnssec_exporter_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful configuration reload",
+		}),
+		logger: logger,
+	}
+
+	r.start(exporter)
+	r.successful.Set(1)
+	r.successTime.SetToCurrentTime()
+
+	return r
+}
+
+// start runs exporter and serves it, and stops the one it replaces.
+func (r *reloader) start(exporter *Exporter) {
+	ctx, stop := context.WithCancel(r.ctx)
+
+	go exporter.Run(ctx)
+
+	r.current.Store(exporter)
+
+	if r.stop != nil {
+		r.stop()
+	}
+
+	r.stop = stop
+}
+
+// Exporter returns the exporter for the configuration that is in use.
+func (r *reloader) Exporter() *Exporter {
+	return r.current.Load()
+}
+
+// Reload reads the configuration file again. An invalid file is reported and
+// the exporter keeps the configuration it has, so a typo cannot stop the
+// checks.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exporter, err := r.load()
+	if err != nil {
+		r.successful.Set(0)
+		return err
+	}
+
+	// With background checks, the new exporter has measured nothing yet. Check
+	// once before it replaces the old one, so the metrics do not go absent
+	// until its first check.
+	if exporter.CheckInterval > 0 {
+		exporter.checkOnce(r.ctx)
+	}
+
+	r.start(exporter)
+	r.successful.Set(1)
+	r.successTime.SetToCurrentTime()
+
+	r.logger.Info("configuration reloaded", "records", len(exporter.Records), "zones", len(exporter.Zones))
+
+	return nil
+}
+
+// Describe sends nothing, which makes the reloader an unchecked collector. A
+// reload can change the custom labels, and with them the descriptions, which a
+// checked collector must not do once it is registered.
+func (r *reloader) Describe(chan<- *prometheus.Desc) {}
+
+// scrapeDuration is reported by the reloader rather than the exporter, because
+// it times the whole collection of the exporter.
+var scrapeDuration = prometheus.NewDesc(
+	"dnssec_exporter_scrape_duration_seconds",
+	"Duration of the collection of the DNSSEC metrics in this scrape",
+	nil,
+	nil,
+)
+
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+
+	r.current.Load().Collect(ch)
+
+	ch <- prometheus.MustNewConstMetric(scrapeDuration, prometheus.GaugeValue, time.Since(start).Seconds())
+
+	r.successful.Collect(ch)
+	r.successTime.Collect(ch)
+}
+
+// ServeHTTP reloads the configuration on POST /-/reload. A GET must not change
+// state, so it is refused.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "reload the configuration with POST", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if err := r.Reload(); err != nil {
+		r.logger.Error("configuration reload failed", "error", err)
+		http.Error(w, "reload failed: "+err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// reloadOnSignal reloads the configuration every time a signal arrives, until
+// ctx is done.
+func (r *reloader) reloadOnSignal(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-signals:
+			if err := r.Reload(); err != nil {
+				r.logger.Error("configuration reload failed", "error", err)
+			}
+		}
+	}
+}
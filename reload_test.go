@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeConfig writes data to path, so a test can change the file between
+// reloads.
+func writeConfig(t *testing.T, path, data string) {
+
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("couldn't write configuration file: %v", err)
+	}
+
+}
+
+// testReloader loads the configuration at path and returns a reloader that
+// reads it again on every reload.
+func testReloader(t *testing.T, path string) *reloader {
+
+	load := func() (*Exporter, error) {
+		return loadExporter(path, time.Second, []string{"127.0.0.1:53"}, nullLogger())
+	}
+
+	exporter, err := load()
+	if err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	return newReloader(t.Context(), exporter, load, nullLogger())
+}
+
+const oneRecord = `
+[[records]]
+  zone = "example.org"
+  record = "@"
+  type = "SOA"
+`
+
+const twoRecords = oneRecord + `
+[[records]]
+  zone = "example.org"
+  record = "www"
+  type = "A"
+`
+
+func TestReloadSwapsConfiguration(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnssec-checks")
+	writeConfig(t, path, oneRecord)
+
+	r := testReloader(t, path)
+
+	writeConfig(t, path, twoRecords)
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("expected the reload to succeed, got: %v", err)
+	}
+
+	if got := len(r.Exporter().Records); got != 2 {
+		t.Fatalf("records after reload = %d, want 2", got)
+	}
+
+	if got := testutil.ToFloat64(r.successful); got != 1 {
+		t.Fatalf("last_reload_successful = %v, want 1", got)
+	}
+
+}
+
+// An invalid file must not replace a working configuration. The exporter keeps
+// checking what it checked before and reports the failed reload.
+func TestReloadKeepsConfigurationOnError(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnssec-checks")
+	writeConfig(t, path, oneRecord)
+
+	r := testReloader(t, path)
+	before := r.Exporter()
+	successTime := testutil.ToFloat64(r.successTime)
+
+	writeConfig(t, path, oneRecord+oneRecord)
+
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected the reload of a duplicated record to fail")
+	}
+
+	if r.Exporter() != before {
+		t.Fatal("an invalid configuration replaced the one in use")
+	}
+
+	if got := testutil.ToFloat64(r.successful); got != 0 {
+		t.Fatalf("last_reload_successful = %v, want 0", got)
+	}
+
+	if got := testutil.ToFloat64(r.successTime); got != successTime {
+		t.Fatalf("last_reload_success_timestamp_seconds changed to %v after a failed reload", got)
+	}
+
+}
+
+func TestReloadHandler(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnssec-checks")
+	writeConfig(t, path, oneRecord)
+
+	r := testReloader(t, path)
+
+	tests := []struct {
+		name   string
+		method string
+		data   string
+		want   int
+	}{
+		{"get is refused", http.MethodGet, twoRecords, http.StatusMethodNotAllowed},
+		{"valid file", http.MethodPost, twoRecords, http.StatusOK},
+		{"invalid file", http.MethodPost, "[[records]\n", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, path, tt.data)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), tt.method, "/-/reload", nil))
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	// Only the valid POST may have replaced the configuration.
+	if got := len(r.Exporter().Records); got != 2 {
+		t.Fatalf("records after the reloads = %d, want 2", got)
+	}
+
+}
+
+// A reload that adds a custom label changes the metric descriptions. The
+// registry must keep serving the metrics after it.
+func TestReloadChangesLabels(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnssec-checks")
+	writeConfig(t, path, oneRecord)
+
+	r := testReloader(t, path)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(r)
+
+	writeConfig(t, path, oneRecord+`  labels = { team = "payments" }`+"\n")
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("expected the reload to succeed, got: %v", err)
+	}
+
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("couldn't gather metrics after the reload: %v", err)
+	}
+
+}
+
+// With background checks, the exporter that a reload puts in use must already
+// have checked, or the metrics would be absent until its first check.
+func TestReloadChecksBeforeSwap(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnssec-checks")
+	writeConfig(t, path, oneRecord)
+
+	r := testReloader(t, path)
+
+	writeConfig(t, path, `check_interval = "1h"`+"\n"+twoRecords)
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("expected the reload to succeed, got: %v", err)
+	}
+
+	if r.Exporter().checked.Load() == nil {
+		t.Fatal("the exporter was put in use before its first check")
+	}
+
+}
+
+func TestReloaderReportsScrapeDuration(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnssec-checks")
+	writeConfig(t, path, oneRecord)
+
+	r := testReloader(t, path)
+
+	if n := testutil.CollectAndCount(r, "dnssec_exporter_scrape_duration_seconds"); n != 1 {
+		t.Fatalf("scrape duration series = %d, want 1", n)
+	}
+
+}
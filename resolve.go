@@ -2,31 +2,60 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-func (e *Exporter) resolve(ctx context.Context, rec Record, resolver string) (resolves bool, expires time.Time) {
+// answer is what a query of a record on a resolver found.
+type answer struct {
+	resolves bool
+	expires  time.Time
+
+	// failure is why the query did not give an RRSIG to measure, or "" when
+	// it did.
+	failure string
+
+	// header is the header of the response, or nil when there was none.
+	header *dns.MsgHdr
+
+	// signatures are the RRSIGs that cover the record, one for each key, when
+	// the record asks for each signature.
+	signatures []signature
+
+	// rrsigs are all the RRSIGs that cover the record.
+	rrsigs []signature
+}
+
+// resolve queries rec on resolver.
+func (e *Exporter) resolve(ctx context.Context, rec Record, resolver Resolver) (ans answer) {
 	name := hostname(rec.Zone, rec.Record)
 
 	msg := &dns.Msg{}
 	msg.SetQuestion(name, dns.StringToType[rec.Type])
 	msg.SetEdns0(4096, true)
 
-	response, _, err := e.dnsClient.ExchangeContext(ctx, msg, resolver)
+	response, err := e.exchange(ctx, msg, resolver)
+
+	ans.failure = queryFailure(response, err)
+
 	if err != nil {
 		e.logger.Error("resolving record failed",
 			"name", name,
 			"type", rec.Type,
 			"zone", rec.Zone,
-			"resolver", resolver,
+			"resolver", resolver.Name,
 			"error", err,
 		)
 		return
 	}
 
-	resolves = response.AuthenticatedData &&
+	ans.header = &response.MsgHdr
+
+	ans.resolves = response.AuthenticatedData &&
 		!response.CheckingDisabled &&
 		response.Rcode == dns.RcodeSuccess
 
@@ -37,15 +66,97 @@ func (e *Exporter) resolve(ctx context.Context, rec Record, resolver string) (re
 			continue
 		}
 
-		sigexp := time.Unix(int64(rrsig.Expiration), 0)
-		if expires.IsZero() || sigexp.Before(expires) {
-			expires = sigexp
+		sig := newSignature(rrsig)
+
+		if ans.expires.IsZero() || sig.expires.Before(ans.expires) {
+			ans.expires = sig.expires
+		}
+
+		ans.rrsigs = append(ans.rrsigs, sig)
+
+		if rec.EachSignature {
+			ans.signatures = addSignature(ans.signatures, sig)
 		}
 	}
 
+	// The resolver answered, but without a signature: the zone is not signed,
+	// or the resolver strips DNSSEC records.
+	if ans.failure == "" && ans.expires.IsZero() {
+		ans.failure = "no_rrsig"
+	}
+
 	return
 }
 
+// exchange sends msg to resolver once the query limits allow it, and counts
+// and times the query. The timeout starts when the query does, so the time it
+// waits for the limits does not count.
+func (e *Exporter) exchange(ctx context.Context, msg *dns.Msg, resolver Resolver) (*dns.Msg, error) {
+	done, err := e.limits.acquire(ctx, resolver.Address)
+	if err != nil {
+		return nil, fmt.Errorf("wait for the query limits: %w", err)
+	}
+	defer done()
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	response, err := e.exchangeOver(ctx, msg, resolver, resolver.Transport)
+
+	// A large answer, such as a DNSKEY set, does not fit in a UDP response. Ask
+	// again over TCP, like a stub resolver does.
+	if err == nil && response.Truncated && resolver.Transport == "udp" {
+		response, err = e.exchangeOver(ctx, msg, resolver, "tcp")
+	}
+
+	if failure := queryFailure(response, err); failure != "" {
+		e.instruments.queryErrors.WithLabelValues(resolver.Name, failure).Inc()
+	}
+
+	return response, err
+}
+
+// exchangeOver sends msg to resolver over transport, and counts and times the
+// query.
+func (e *Exporter) exchangeOver(ctx context.Context, msg *dns.Msg, resolver Resolver, transport string) (*dns.Msg, error) {
+	start := time.Now()
+	response, _, err := e.clients[transport].ExchangeContext(ctx, msg, resolver.Address)
+
+	e.instruments.queryDuration.WithLabelValues(resolver.Name).Observe(time.Since(start).Seconds())
+	e.instruments.queries.WithLabelValues(resolver.Name).Inc()
+
+	return response, err
+}
+
+// addSignature adds sig to signatures. Of two signatures by the same key, which
+// would be reported with the same labels, it keeps the earlier.
+func addSignature(signatures []signature, sig signature) []signature {
+	i := slices.IndexFunc(signatures, func(other signature) bool {
+		return other.keyTag == sig.keyTag &&
+			other.algorithm == sig.algorithm &&
+			dns.CanonicalName(other.signer) == dns.CanonicalName(sig.signer)
+	})
+
+	switch {
+	case i < 0:
+		return append(signatures, sig)
+	case sig.expires.Before(signatures[i].expires):
+		signatures[i] = sig
+	}
+
+	return signatures
+}
+
+// algorithmName returns the mnemonic of a DNSSEC algorithm, or its number when
+// it has none.
+func algorithmName(algorithm uint8) string {
+	if name, ok := dns.AlgorithmToString[algorithm]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(algorithm))
+}
+
 func hostname(zone, record string) string {
 	if record == "@" {
 		return dns.Fqdn(zone)
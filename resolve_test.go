@@ -4,10 +4,12 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"net"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 type opts struct {
@@ -16,6 +18,10 @@ type opts struct {
 	rcode           int
 	unauthenticated bool
 	noedns0support  bool
+
+	// rollover signs the SOA with a second key too, as during a key rollover.
+	// Its signature expires a day after the first.
+	rollover bool
 }
 
 func runServer(t *testing.T, opts opts) ([]string, func()) {
@@ -39,6 +45,17 @@ func runServer(t *testing.T, opts opts) ([]string, func()) {
 		t.Fatalf("couldn't generate private key: %v", err)
 	}
 
+	newkey := &dns.DNSKEY{
+		Algorithm: dns.ECDSAP256SHA256,
+		Flags:     dns.ZONE,
+		Protocol:  3,
+	}
+
+	newprivkey, err := newkey.Generate(256)
+	if err != nil {
+		t.Fatalf("couldn't generate private key: %v", err)
+	}
+
 	h := dns.NewServeMux()
 	h.HandleFunc("example.org.", func(rw dns.ResponseWriter, msg *dns.Msg) {
 
@@ -62,6 +79,15 @@ func runServer(t *testing.T, opts opts) ([]string, func()) {
 
 		switch q.Qtype {
 
+		// The key of a rollover is not published, so its signatures are
+		// orphaned.
+		case dns.TypeDNSKEY:
+
+			key := *dnskey
+			key.Hdr = dns.RR_Header{Name: q.Name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600}
+
+			msg.Answer = append(msg.Answer, &key)
+
 		case dns.TypeSOA:
 
 			rrHeader := dns.RR_Header{
@@ -95,6 +121,21 @@ func runServer(t *testing.T, opts opts) ([]string, func()) {
 
 			msg.Answer = append(msg.Answer, rrsig)
 
+			if !opts.rollover {
+				break
+			}
+
+			newsig := *rrsig
+			newsig.KeyTag = newkey.KeyTag()
+			newsig.Expiration = uint32(opts.expires.Add(24 * time.Hour).Unix())
+
+			if err := newsig.Sign(newprivkey.(*ecdsa.PrivateKey), []dns.RR{soa}); err != nil {
+				t.Errorf("couldn't sign SOA record: %v", err)
+				return
+			}
+
+			msg.Answer = append(msg.Answer, &newsig)
+
 		}
 
 		msg.AuthenticatedData = !opts.unauthenticated && !opts.noedns0support
@@ -136,6 +177,82 @@ func runServer(t *testing.T, opts opts) ([]string, func()) {
 
 }
 
+// runTruncatingServer serves the SOA of example.org with an RRSIG over TCP, and
+// a truncated response without them over UDP, on the same port.
+func runTruncatingServer(t *testing.T) string {
+
+	h := dns.NewServeMux()
+	h.HandleFunc("example.org.", func(rw dns.ResponseWriter, msg *dns.Msg) {
+
+		msg.SetReply(msg)
+
+		if rw.RemoteAddr().Network() == "udp" {
+			msg.Truncated = true
+		} else {
+			soa, _ := dns.NewRR("example.org. 3600 IN SOA ns1.example.org. test.example.org. 1 14400 3600 7200 60")
+			rrsig, _ := dns.NewRR("example.org. 3600 IN RRSIG SOA 13 2 3600 20300101000000 20200101000000 12345 example.org. AAAA")
+
+			msg.Answer = append(msg.Answer, soa, rrsig)
+		}
+
+		if err := rw.WriteMsg(msg); err != nil {
+			t.Errorf("couldn't write message: %v", err)
+		}
+
+	})
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	pc, err := lc.ListenPacket(t.Context(), "udp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	tcp := &dns.Server{Listener: ln, Handler: h}
+	udp := &dns.Server{PacketConn: pc, Handler: h}
+
+	go func() { _ = tcp.ActivateAndServe() }()
+	go func() { _ = udp.ActivateAndServe() }()
+
+	t.Cleanup(func() {
+		_ = tcp.Shutdown()
+		_ = udp.Shutdown()
+	})
+
+	return ln.Addr().String()
+}
+
+// A DNSKEY set or a record with several signatures often does not fit in a UDP
+// response, and must not fail on a resolver that uses udp.
+func TestResolveRetriesTruncatedOverTCP(t *testing.T) {
+
+	addr := runTruncatingServer(t)
+
+	e := NewDNSSECExporter(time.Second, nil, nullLogger())
+	e.Resolvers = []Resolver{{Name: "local", Address: addr, Transport: "udp"}}
+	e.Records = []Record{soaRecord()}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	ans := e.resolve(t.Context(), soaRecord(), e.resolvers[0])
+
+	if ans.failure != "" || ans.expires.IsZero() {
+		t.Fatalf("expected the signature over TCP, got failure %q", ans.failure)
+	}
+
+	if got := testutil.ToFloat64(e.instruments.queries.WithLabelValues("local")); got != 2 {
+		t.Fatalf("queries = %v, want the UDP query and the TCP one", got)
+	}
+
+}
+
 func TestExpirationOK(t *testing.T) {
 
 	addr, cancel := runServer(t, opts{})
@@ -143,7 +260,7 @@ func TestExpirationOK(t *testing.T) {
 
 	e := NewDNSSECExporter(time.Second, addr, nullLogger())
 
-	_, exp := e.resolve(context.Background(), soaRecord(), addr[0])
+	exp := e.resolve(context.Background(), soaRecord(), e.resolvers[0]).expires
 
 	if exp.Before(time.Now()) {
 		t.Fatalf("expected expiration to be in the future, was: %v", exp)
@@ -162,7 +279,7 @@ func TestExpired(t *testing.T) {
 
 	e := NewDNSSECExporter(time.Second, addr, nullLogger())
 
-	_, exp := e.resolve(context.Background(), soaRecord(), addr[0])
+	exp := e.resolve(context.Background(), soaRecord(), e.resolvers[0]).expires
 
 	if exp.After(time.Now()) {
 		t.Fatalf("expected expiration to be in the past, was: %v", exp)
@@ -181,7 +298,7 @@ func TestValid(t *testing.T) {
 
 	e := NewDNSSECExporter(time.Second, addr, nullLogger())
 
-	valid, _ := e.resolve(context.Background(), soaRecord(), addr[0])
+	valid := e.resolve(context.Background(), soaRecord(), e.resolvers[0]).resolves
 
 	if !valid {
 		t.Fatal("expected valid result")
@@ -199,7 +316,7 @@ func TestInvalidError(t *testing.T) {
 
 	e := NewDNSSECExporter(time.Second, addr, nullLogger())
 
-	valid, _ := e.resolve(context.Background(), soaRecord(), addr[0])
+	valid := e.resolve(context.Background(), soaRecord(), e.resolvers[0]).resolves
 
 	if valid {
 		t.Fatal("expected invalid result")
@@ -217,7 +334,7 @@ func TestInvalidUnauthenticated(t *testing.T) {
 
 	e := NewDNSSECExporter(time.Second, addr, nullLogger())
 
-	valid, _ := e.resolve(context.Background(), soaRecord(), addr[0])
+	valid := e.resolve(context.Background(), soaRecord(), e.resolvers[0]).resolves
 
 	if valid {
 		t.Fatal("expected invalid result")
@@ -235,7 +352,7 @@ func TestNoEDNS0Support(t *testing.T) {
 
 	e := NewDNSSECExporter(time.Second, addr, nullLogger())
 
-	valid, _ := e.resolve(context.Background(), soaRecord(), addr[0])
+	valid := e.resolve(context.Background(), soaRecord(), e.resolvers[0]).resolves
 
 	if valid {
 		t.Fatal("expected invalid result")
@@ -243,6 +360,173 @@ func TestNoEDNS0Support(t *testing.T) {
 
 }
 
+// A check that has no expiry to report must say why, so an alert can tell a
+// broken resolver from an unsigned zone.
+func TestResolveFailure(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts opts
+		want string
+	}{
+		{"signed", opts{}, ""},
+		{"servfail", opts{rcode: dns.RcodeServerFailure}, "servfail"},
+		{"no signature", opts{noedns0support: true}, "no_rrsig"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, cancel := runServer(t, tt.opts)
+			defer cancel()
+
+			e := NewDNSSECExporter(time.Second, addr, nullLogger())
+
+			if failure := e.resolve(t.Context(), soaRecord(), e.resolvers[0]).failure; failure != tt.want {
+				t.Fatalf("failure = %q, want %q", failure, tt.want)
+			}
+		})
+	}
+
+}
+
+// During a rollover, a record that asks for each signature reports the
+// signatures of both keys, and a record that does not reports neither.
+func TestEachSignature(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{rollover: true})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, addr, nullLogger())
+
+	rec := soaRecord()
+	rec.EachSignature = true
+
+	ans := e.resolve(t.Context(), rec, e.resolvers[0])
+
+	if len(ans.signatures) != 2 {
+		t.Fatalf("expected a signature for each key, got %d", len(ans.signatures))
+	}
+
+	if ans.signatures[0].keyTag == ans.signatures[1].keyTag {
+		t.Fatalf("expected the signatures of two keys, got key tag %d twice", ans.signatures[0].keyTag)
+	}
+
+	// The earliest expiry is still that of the first key.
+	if !ans.expires.Equal(ans.signatures[0].expires) {
+		t.Fatalf("expires = %v, want the earliest signature %v", ans.expires, ans.signatures[0].expires)
+	}
+
+	if ans := e.resolve(t.Context(), soaRecord(), e.resolvers[0]); ans.signatures != nil {
+		t.Fatalf("expected no signatures for a record that does not ask for them, got %v", ans.signatures)
+	}
+
+	e.Records = []Record{rec}
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_rrsig_expiry"); n != 2 {
+		t.Fatalf("expected a rrsig_expiry series for each key, got %d", n)
+	}
+
+}
+
+// A signature made by a key that the DNSKEY set does not have is orphaned,
+// such as one left over from a rollover.
+func TestRecordOrphanedRRSIGs(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts opts
+		want float64
+	}{
+		{"published key", opts{}, 0},
+		{"unpublished key", opts{rollover: true}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, cancel := runServer(t, tt.opts)
+			defer cancel()
+
+			rec := soaRecord()
+			rec.CheckOrphans = true
+
+			e := NewDNSSECExporter(time.Second, addr, nullLogger())
+			e.Records = []Record{rec}
+
+			if got := testutil.ToFloat64(collectOne(t, e, "dnssec_zone_record_orphaned_rrsigs")); got != tt.want {
+				t.Fatalf("orphaned_rrsigs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+}
+
+// The DNSKEY query adds load on the resolvers, so a record that does not ask
+// for the orphaned signatures does not send it.
+func TestRecordOrphanedRRSIGsOptIn(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{rollover: true})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, addr, nullLogger())
+	e.Records = []Record{soaRecord()}
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_record_orphaned_rrsigs"); n != 0 {
+		t.Fatalf("expected no orphaned_rrsigs series, got %d", n)
+	}
+
+	if got := testutil.ToFloat64(e.instruments.queries.WithLabelValues(addr[0])); got != 1 {
+		t.Fatalf("queries = %v, want only the query of the record", got)
+	}
+
+}
+
+// The records of a zone share the DNSKEY set of one check, so a zone with many
+// records costs one more query rather than one for each record.
+func TestKeySetsQueryOnce(t *testing.T) {
+
+	addr, cancel := runServer(t, opts{})
+	defer cancel()
+
+	e := NewDNSSECExporter(time.Second, addr, nullLogger())
+	sets := newKeySets()
+
+	for range 3 {
+		if _, err := sets.get(t.Context(), e, e.resolvers[0], "example.org"); err != nil {
+			t.Fatalf("expected the DNSKEY set, got: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(e.instruments.queries.WithLabelValues(addr[0])); got != 1 {
+		t.Fatalf("queries = %v, want 1", got)
+	}
+
+}
+
+func TestAddSignatureKeepsEarliestOfKey(t *testing.T) {
+
+	sig := func(keyTag uint16, signer string, expires int64) signature {
+		return signature{keyTag: keyTag, algorithm: dns.ECDSAP256SHA256, signer: signer, expires: time.Unix(expires, 0)}
+	}
+
+	var signatures []signature
+
+	for _, s := range []signature{
+		sig(1, "example.org.", 200),
+		sig(2, "example.org.", 300),
+		sig(1, "EXAMPLE.org.", 100),
+		sig(2, "example.org.", 400),
+	} {
+		signatures = addSignature(signatures, s)
+	}
+
+	want := []signature{sig(1, "EXAMPLE.org.", 100), sig(2, "example.org.", 300)}
+
+	if !slices.Equal(signatures, want) {
+		t.Fatalf("signatures = %v, want %v", signatures, want)
+	}
+
+}
+
 func TestHostname(t *testing.T) {
 
 	tests := []struct {
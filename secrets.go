@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// loadSecrets fills in the secret of every key that reads it from a file, an
+// environment variable or a BIND key file. It runs on every load, so a reload
+// picks up a rotated secret. The errors never hold a secret, only where the
+// exporter looked for it.
+func loadSecrets(keys []Key) ([]Key, error) {
+	loaded := make([]Key, 0, len(keys))
+
+	for _, key := range keys {
+		key, err := loadSecret(key)
+		if err != nil {
+			return nil, inFile(key.source, err)
+		}
+
+		loaded = append(loaded, key)
+	}
+
+	return loaded, nil
+}
+
+func loadSecret(key Key) (Key, error) {
+	set := 0
+
+	for _, value := range []string{key.Secret, key.SecretFile, key.SecretEnv, key.BindFile} {
+		if value != "" {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return key, fmt.Errorf("key %s sets more than one of secret, secret_file, secret_env and bind_file, set only one", key.Name)
+	}
+
+	var err error
+
+	switch {
+	case key.SecretFile != "":
+		key.Secret, err = secretFromFile(key.source, key.SecretFile, "secret_file")
+		if err != nil {
+			return key, fmt.Errorf("key %s: %w", key.Name, err)
+		}
+
+	case key.SecretEnv != "":
+		key.Secret, err = secretFromEnv(key.SecretEnv, "secret_env")
+		if err != nil {
+			return key, fmt.Errorf("key %s: %w", key.Name, err)
+		}
+
+	case key.BindFile != "":
+		if key.Algorithm != "" {
+			return key, fmt.Errorf("key %s: bind_file sets the algorithm, remove algorithm", key.Name)
+		}
+
+		data, err := os.ReadFile(relativeTo(key.source, key.BindFile))
+		if err != nil {
+			return key, fmt.Errorf("key %s: read bind_file: %w", key.Name, err)
+		}
+
+		bindKey, err := bindFileKey(string(data), key.Name)
+		if err != nil {
+			return key, fmt.Errorf("bind_file %s: %w", key.BindFile, err)
+		}
+
+		key.Name = bindKey.Name
+		key.Algorithm = bindKey.Algorithm
+		key.Secret = bindKey.Secret
+	}
+
+	return key, nil
+}
+
+// secretFromFile reads a secret from the file at path. setting is the setting
+// that names the file, for errors.
+func secretFromFile(source, path, setting string) (string, error) {
+	data, err := os.ReadFile(relativeTo(source, path))
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", setting, err)
+	}
+
+	// A file written by hand or by a secret store usually ends in a newline,
+	// which is not part of the secret.
+	secret := strings.TrimSpace(string(data))
+
+	if secret == "" {
+		return "", fmt.Errorf("%s %s is empty", setting, path)
+	}
+
+	return secret, nil
+}
+
+// secretFromEnv reads a secret from the environment variable name. setting is
+// the setting that names the variable, for errors.
+func secretFromEnv(name, setting string) (string, error) {
+	secret := strings.TrimSpace(os.Getenv(name))
+
+	if secret == "" {
+		return "", fmt.Errorf("environment variable %s from %s is not set", name, setting)
+	}
+
+	return secret, nil
+}
+
+// bindFileKey reads the key called name from a BIND key file, as tsig-keygen
+// writes it. An empty name picks the only key in the file.
+func bindFileKey(data, name string) (Key, error) {
+	statements, err := parseBind(data)
+	if err != nil {
+		return Key{}, err
+	}
+
+	var keys []Key
+
+	for _, stmt := range statements {
+		if stmt.arg(0) != "key" {
+			continue
+		}
+
+		key := Key{Name: stmt.arg(1)}
+
+		for _, option := range stmt.block {
+			switch option.arg(0) {
+			case "algorithm":
+				key.Algorithm = option.arg(1)
+			case "secret":
+				key.Secret = option.arg(1)
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	if name == "" {
+		if len(keys) != 1 {
+			return Key{}, fmt.Errorf("the file has %d keys, give the key a name to pick one", len(keys))
+		}
+
+		return keys[0], nil
+	}
+
+	for _, key := range keys {
+		if dns.Fqdn(key.Name) == dns.Fqdn(name) {
+			return key, nil
+		}
+	}
+
+	return Key{}, errors.New("the file has no key called " + name)
+}
+
+// relativeTo resolves path relative to the directory of the configuration file
+// it was given in, like an include.
+func relativeTo(source, path string) string {
+	if source == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(source), path)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecret = "mvgDxfYTSe8L+pp7h4r+PIeTc67YTPhGWZrhmIi2Rpo="
+
+// keygenOutput is a key file as tsig-keygen writes it.
+const keygenOutput = `key "transfer" {
+	algorithm hmac-sha256;
+	secret "` + testSecret + `";
+};
+`
+
+func TestLoadSecrets(t *testing.T) {
+
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"secret":        testSecret + "\n",
+		"empty":         "\n",
+		"transfer.key":  keygenOutput,
+		"broken.key":    `key "transfer" { secret "` + testSecret + `" };`,
+		"two-keys.conf": keygenOutput + `key "other." { algorithm hmac-sha512; secret "c2VjcmV0"; };`,
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("couldn't write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("DNSSEC_TEST_SECRET", testSecret)
+
+	// Relative paths are relative to the file the key was read from.
+	source := filepath.Join(dir, "dnssec-checks")
+
+	tests := []struct {
+		name    string
+		key     Key
+		want    Key
+		wantErr string
+	}{
+		{
+			name: "secret in the configuration file",
+			key:  Key{Name: "k.", Algorithm: "hmac-sha256", Secret: testSecret},
+			want: Key{Name: "k.", Algorithm: "hmac-sha256", Secret: testSecret},
+		},
+		{
+			name: "secret_file",
+			key:  Key{Name: "k.", Algorithm: "hmac-sha256", SecretFile: "secret"},
+			want: Key{Name: "k.", Algorithm: "hmac-sha256", Secret: testSecret},
+		},
+		{
+			name:    "empty secret_file",
+			key:     Key{Name: "k.", Algorithm: "hmac-sha256", SecretFile: "empty"},
+			wantErr: "is empty",
+		},
+		{
+			name:    "missing secret_file",
+			key:     Key{Name: "k.", Algorithm: "hmac-sha256", SecretFile: "missing"},
+			wantErr: "read secret_file",
+		},
+		{
+			name: "secret_env",
+			key:  Key{Name: "k.", Algorithm: "hmac-sha256", SecretEnv: "DNSSEC_TEST_SECRET"},
+			want: Key{Name: "k.", Algorithm: "hmac-sha256", Secret: testSecret},
+		},
+		{
+			name:    "unset secret_env",
+			key:     Key{Name: "k.", Algorithm: "hmac-sha256", SecretEnv: "DNSSEC_TEST_UNSET"},
+			wantErr: "DNSSEC_TEST_UNSET from secret_env is not set",
+		},
+		{
+			name: "bind_file with one key",
+			key:  Key{BindFile: "transfer.key"},
+			want: Key{Name: "transfer", Algorithm: "hmac-sha256", Secret: testSecret},
+		},
+		{
+			name: "bind_file picks the named key",
+			key:  Key{Name: "transfer.", BindFile: "two-keys.conf"},
+			want: Key{Name: "transfer", Algorithm: "hmac-sha256", Secret: testSecret},
+		},
+		{
+			name:    "bind_file with two keys and no name",
+			key:     Key{BindFile: "two-keys.conf"},
+			wantErr: "has 2 keys",
+		},
+		{
+			name:    "bind_file without the named key",
+			key:     Key{Name: "missing.", BindFile: "transfer.key"},
+			wantErr: "no key called missing.",
+		},
+		{
+			name:    "broken bind_file",
+			key:     Key{BindFile: "broken.key"},
+			wantErr: `"secret" statement is missing a ;`,
+		},
+		{
+			name:    "bind_file and algorithm",
+			key:     Key{Algorithm: "hmac-sha256", BindFile: "transfer.key"},
+			wantErr: "remove algorithm",
+		},
+		{
+			name:    "secret and secret_env",
+			key:     Key{Name: "k.", Algorithm: "hmac-sha256", Secret: testSecret, SecretEnv: "DNSSEC_TEST_SECRET"},
+			wantErr: "set only one",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.key.source = source
+
+			keys, err := loadSecrets([]Key{tt.key})
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				if strings.Contains(err.Error(), testSecret) {
+					t.Fatalf("the error contains the secret: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			got := keys[0]
+			if got.Name != tt.want.Name || got.Algorithm != tt.want.Algorithm || got.Secret != tt.want.Secret {
+				t.Fatalf("key = %s with secret %q, want %s with secret %q", got, got.Secret, tt.want, tt.want.Secret)
+			}
+		})
+	}
+
+}
+
+// A key that reads its secret from a file must load and validate like one with
+// the secret in the configuration file, and the redaction must still hold.
+func TestLoadExporterSecretFile(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dnssec-checks")
+
+	writeConfig(t, filepath.Join(dir, "transfer.key"), keygenOutput)
+	writeConfig(t, path, `
+[[zones]]
+  zone = "example.com"
+  key = "transfer"
+
+[[keys]]
+  bind_file = "transfer.key"
+`)
+
+	e, err := loadExporter(path, 0, []string{"127.0.0.1:53"}, nullLogger())
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	key, ok := e.keys["transfer."]
+	if !ok || key.Secret != testSecret {
+		t.Fatalf("the key index does not hold transfer. with its secret: %v", e.keys)
+	}
+
+	if strings.Contains(key.String(), testSecret) {
+		t.Fatalf("String() contains the secret: %s", key)
+	}
+
+}
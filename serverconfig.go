@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// localServer is the server that a [[server_configs]] entry transfers from
+// when it sets none. The exporter reads the file of the server, so it runs on
+// the same host.
+const localServer = "127.0.0.1:53"
+
+// bindZoneTypes are the types of BIND zone that hold the whole zone, and can
+// be transferred. Hint, stub and forward zones hold no signatures.
+var bindZoneTypes = map[string]bool{
+	"primary":   true,
+	"master":    true,
+	"secondary": true,
+	"slave":     true,
+}
+
+// namedConfZones returns the zones in a named.conf and the files it includes,
+// in the order they appear. A zone in more than one view is listed once. With
+// signedOnly, only the zones with a dnssec-policy other than none are listed.
+func namedConfZones(path string, signedOnly bool) ([]string, error) {
+	statements, err := readNamedConf(path, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		zones []string
+		seen  = make(map[string]bool)
+	)
+
+	add := func(stmt bindStatement, policy string) {
+		name, ok := bindZone(stmt, policy, signedOnly)
+		if !ok || seen[dns.Fqdn(name)] {
+			return
+		}
+
+		seen[dns.Fqdn(name)] = true
+
+		zones = append(zones, zoneLabel(dns.Fqdn(name)))
+	}
+
+	// A dnssec-policy in options or in a view applies to the zones that set
+	// none.
+	policy := bindOption(statements, "options", "dnssec-policy")
+
+	for _, stmt := range statements {
+		switch stmt.arg(0) {
+		case "zone":
+			add(stmt, policy)
+
+		case "view":
+			viewPolicy := policy
+			if p := bindSetting(stmt.block, "dnssec-policy"); p != "" {
+				viewPolicy = p
+			}
+
+			for _, inner := range stmt.block {
+				if inner.arg(0) == "zone" {
+					add(inner, viewPolicy)
+				}
+			}
+		}
+	}
+
+	return zones, nil
+}
+
+// bindZone returns the name of the zone statement stmt, and whether it is a
+// zone to monitor.
+func bindZone(stmt bindStatement, policy string, signedOnly bool) (string, bool) {
+	name := stmt.arg(1)
+	if name == "" {
+		return "", false
+	}
+
+	// Only the IN class holds DNSSEC signed zones.
+	if class := stmt.arg(2); class != "" && !strings.EqualFold(class, "IN") {
+		return "", false
+	}
+
+	if !bindZoneTypes[bindSetting(stmt.block, "type")] {
+		return "", false
+	}
+
+	if p := bindSetting(stmt.block, "dnssec-policy"); p != "" {
+		policy = p
+	}
+
+	if signedOnly && (policy == "" || policy == "none") {
+		return "", false
+	}
+
+	return name, true
+}
+
+// bindSetting returns the first argument of the statement named name in block,
+// or "" when the block has none.
+func bindSetting(block []bindStatement, name string) string {
+	for _, stmt := range block {
+		if stmt.arg(0) == name {
+			return stmt.arg(1)
+		}
+	}
+
+	return ""
+}
+
+// bindOption returns a setting in the first top level statement named
+// statement, such as dnssec-policy in options.
+func bindOption(statements []bindStatement, statement, name string) string {
+	for _, stmt := range statements {
+		if stmt.arg(0) == statement {
+			return bindSetting(stmt.block, name)
+		}
+	}
+
+	return ""
+}
+
+// readNamedConf parses a named.conf, and replaces every include statement with
+// the statements of the file it names. A relative path is relative to the file
+// that includes it. seen holds the files already read, so an include loop is an
+// error.
+func readNamedConf(path string, seen map[string]bool) ([]bindStatement, error) {
+	if seen[path] {
+		return nil, fmt.Errorf("%s is included more than once", path)
+	}
+
+	seen[path] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read named.conf: %w", err)
+	}
+
+	statements, err := parseBind(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	return expandBindIncludes(path, statements, seen)
+}
+
+// expandBindIncludes replaces the include statements in statements and in the
+// blocks below them, because BIND accepts an include anywhere.
+func expandBindIncludes(path string, statements []bindStatement, seen map[string]bool) ([]bindStatement, error) {
+	expanded := make([]bindStatement, 0, len(statements))
+
+	for _, stmt := range statements {
+		if stmt.arg(0) != "include" {
+			if stmt.block != nil {
+				block, err := expandBindIncludes(path, stmt.block, seen)
+				if err != nil {
+					return nil, err
+				}
+
+				stmt.block = block
+			}
+
+			expanded = append(expanded, stmt)
+
+			continue
+		}
+
+		if stmt.arg(1) == "" {
+			return nil, fmt.Errorf("%s: include names no file", path)
+		}
+
+		files, err := includedFiles(relativeTo(path, stmt.arg(1)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %q: %w", path, stmt.arg(1), err)
+		}
+
+		for _, file := range files {
+			included, err := readNamedConf(file, seen)
+			if err != nil {
+				return nil, err
+			}
+
+			expanded = append(expanded, included...)
+		}
+	}
+
+	return expanded, nil
+}
+
+// knotItem is one item in a list section of a knot.conf, such as a zone or a
+// template, with the settings the exporter reads.
+type knotItem map[string]string
+
+// knotConfZones returns the zones in the zone section of a knot.conf and the
+// files it includes. With signedOnly, only the zones with dnssec-signing on,
+// set on the zone or on its template, are listed.
+func knotConfZones(path string, signedOnly bool) ([]string, error) {
+	sections := make(map[string][]knotItem)
+
+	if err := readKnotConf(path, sections, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string]knotItem)
+	for _, template := range sections["template"] {
+		templates[template["id"]] = template
+	}
+
+	var (
+		zones []string
+		seen  = make(map[string]bool)
+	)
+
+	for _, zone := range sections["zone"] {
+		name := zone["domain"]
+		if name == "" || seen[dns.Fqdn(name)] {
+			continue
+		}
+
+		if signedOnly && !knotSigned(zone, templates) {
+			continue
+		}
+
+		seen[dns.Fqdn(name)] = true
+
+		zones = append(zones, zoneLabel(dns.Fqdn(name)))
+	}
+
+	return zones, nil
+}
+
+// knotSigned reports whether Knot signs zone. A zone without dnssec-signing
+// takes it from its template, or from the default template.
+func knotSigned(zone knotItem, templates map[string]knotItem) bool {
+	signing, ok := zone["dnssec-signing"]
+	if !ok {
+		id := zone["template"]
+		if id == "" {
+			id = "default"
+		}
+
+		signing = templates[id]["dnssec-signing"]
+	}
+
+	switch strings.ToLower(signing) {
+	case "on", "true":
+		return true
+	}
+
+	return false
+}
+
+// readKnotConf reads the list sections of a knot.conf into sections, and the
+// files that it includes. A relative include is relative to the file.
+func readKnotConf(path string, sections map[string][]knotItem, seen map[string]bool) error {
+	if seen[path] {
+		return fmt.Errorf("%s is included more than once", path)
+	}
+
+	seen[path] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read knot.conf: %w", err)
+	}
+
+	includes, err := parseKnot(string(data), sections)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for _, include := range includes {
+		files, err := includedFiles(relativeTo(path, include))
+		if err != nil {
+			return fmt.Errorf("%s: include %q: %w", path, include, err)
+		}
+
+		for _, file := range files {
+			if err := readKnotConf(file, sections, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseKnot reads the list sections of a knot.conf, such as zone and template,
+// into sections, and returns the files it includes. A knot.conf is YAML, but
+// Knot only accepts a small part of YAML: top level sections that hold a list
+// of items with one setting a line. parseKnot reads that part, and skips the
+// lists within an item, which the exporter has no use for.
+func parseKnot(data string, sections map[string][]knotItem) ([]string, error) {
+	var (
+		includes []string
+		section  string
+		item     knotItem
+		indent   int
+	)
+
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(knotComment(line), " \t\r")
+
+		content := strings.TrimLeft(line, " ")
+		if content == "" {
+			continue
+		}
+
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n+1)
+		}
+
+		depth := len(line) - len(content)
+
+		// The items of a section can start at the first column.
+		if depth == 0 && !strings.HasPrefix(content, "- ") {
+			key, value, ok := knotSetting(content)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected a section", n+1)
+			}
+
+			section, item = "", nil
+
+			switch {
+			case key == "include":
+				includes = append(includes, value)
+
+			case value == "":
+				section = key
+
+			case strings.HasPrefix(value, "["):
+				return nil, fmt.Errorf("line %d: write the %s section as one item a line, not in brackets", n+1, key)
+			}
+
+			continue
+		}
+
+		if section == "" {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(content, "- "); ok && (item == nil || depth < indent) {
+			item = make(knotItem)
+			sections[section] = append(sections[section], item)
+			indent = depth + 2
+			content = rest
+			depth = indent
+		}
+
+		// A deeper line is part of a list within the item.
+		if item == nil || depth != indent {
+			continue
+		}
+
+		key, value, ok := knotSetting(content)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a setting", n+1)
+		}
+
+		item[key] = value
+	}
+
+	return includes, nil
+}
+
+// knotSetting splits a "key: value" line, and removes the quotes around the
+// value.
+func knotSetting(line string) (string, string, bool) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok || key == "" {
+		return "", "", false
+	}
+
+	value = strings.TrimSpace(value)
+
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	return strings.TrimSpace(key), value, true
+}
+
+// knotComment removes a comment from line. A # starts a comment at the start of
+// the line or after a space, outside quotes.
+func knotComment(line string) string {
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+
+		case c == '"' || c == '\'':
+			quote = c
+
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
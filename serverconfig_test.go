@@ -0,0 +1,267 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles writes every file in files to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("couldn't write %s: %v", name, err)
+		}
+	}
+
+}
+
+const testNamedConf = `
+options {
+	directory "/var/cache/bind";
+	dnssec-policy default;
+};
+
+// The root hints hold no signatures.
+zone "." { type hint; file "/usr/share/dns/root.hints"; };
+
+zone "example.com" {
+	type primary;
+	file "example.com.db";
+};
+
+zone "unsigned.example" IN {
+	type primary;
+	dnssec-policy none;
+	file "unsigned.example.db";
+};
+
+zone "bind" CH { type primary; file "bind.db"; };
+
+include "zones.conf";
+`
+
+const testNamedZones = `
+view "internal" {
+	zone "example.net." { type secondary; primaries { 192.0.2.1; }; };
+	zone "example.com" { type primary; file "internal/example.com.db"; };
+};
+
+view "external" {
+	dnssec-policy none;
+	zone "example.org" { type slave; masters { 192.0.2.1; }; };
+	zone "forwarded.example" { type forward; forwarders { 192.0.2.53; }; };
+};
+`
+
+func TestNamedConfZones(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"named.conf": testNamedConf, "zones.conf": testNamedZones})
+
+	tests := []struct {
+		name       string
+		signedOnly bool
+		want       []string
+	}{
+		{"all", false, []string{"example.com", "unsigned.example", "example.net", "example.org"}},
+		{"signed only", true, []string{"example.com", "example.net"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zones, err := namedConfZones(filepath.Join(dir, "named.conf"), tt.signedOnly)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if !slices.Equal(zones, tt.want) {
+				t.Fatalf("zones = %v, want %v", zones, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestNamedConfIncludeLoop(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"named.conf": `include "named.conf";`})
+
+	_, err := namedConfZones(filepath.Join(dir, "named.conf"), false)
+	if err == nil || !strings.Contains(err.Error(), "included more than once") {
+		t.Fatalf("expected an include loop error, got: %v", err)
+	}
+
+}
+
+const testKnotConf = `
+server:
+    listen: 0.0.0.0@53
+
+template:
+  - id: default
+    dnssec-signing: on
+  - id: unsigned
+    dnssec-signing: off # signed offline
+
+zone:
+  - domain: example.com
+    acl:
+      - transfer
+      - notify
+  - domain: "unsigned.example."
+    template: unsigned
+  - domain: example.com
+
+include: zones/*.conf
+`
+
+const testKnotZones = `
+zone:
+- domain: example.net
+  dnssec-signing: false
+- domain: example.org
+`
+
+func TestKnotConfZones(t *testing.T) {
+
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "zones"), 0o700); err != nil {
+		t.Fatalf("couldn't create directory: %v", err)
+	}
+
+	writeFiles(t, dir, map[string]string{"knot.conf": testKnotConf, "zones/more.conf": testKnotZones})
+
+	tests := []struct {
+		name       string
+		signedOnly bool
+		want       []string
+	}{
+		{"all", false, []string{"example.com", "unsigned.example", "example.net", "example.org"}},
+		{"signed only", true, []string{"example.com", "example.org"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zones, err := knotConfZones(filepath.Join(dir, "knot.conf"), tt.signedOnly)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if !slices.Equal(zones, tt.want) {
+				t.Fatalf("zones = %v, want %v", zones, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestParseKnotErrors(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"flow list", "zone: [ { domain: example.com } ]\n", "not in brackets"},
+		{"tab indent", "zone:\n\t- domain: example.com\n", "not tabs"},
+		{"no setting", "zone:\n  - domain: example.com\n    example.net\n", "line 3: expected a setting"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseKnot(tt.data, make(map[string][]knotItem))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+}
+
+// The zones from the file are transferred from the local server unless the
+// entry names another, because the file is read on the server itself.
+func TestServerConfigZones(t *testing.T) {
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"named.conf": testNamedConf, "zones.conf": testNamedZones})
+
+	e := NewDNSSECExporter(time.Second, []string{"192.0.2.53:53"}, nullLogger())
+	e.ServerConfigs = []ServerConfig{{
+		NamedConf:  filepath.Join(dir, "named.conf"),
+		SignedOnly: true,
+		Labels:     map[string]string{"team": "dns"},
+	}}
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got: %v", err)
+	}
+
+	zones, ok := e.sources[0].get(t.Context(), e)
+	if !ok {
+		t.Fatal("expected the file to be read")
+	}
+
+	if len(zones) != 2 {
+		t.Fatalf("zones = %v, want 2", zones)
+	}
+
+	for _, zone := range zones {
+		if zone.Server != localServer || zone.Labels["team"] != "dns" {
+			t.Fatalf("zone %s has server %s and labels %v", zone.Zone, zone.Server, zone.Labels)
+		}
+	}
+
+	if e.sources[0].kind != "bind" {
+		t.Fatalf("kind = %q, want bind", e.sources[0].kind)
+	}
+
+}
+
+func TestValidateServerConfigs(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		entry   ServerConfig
+		wantErr string
+	}{
+		{name: "named.conf", entry: ServerConfig{NamedConf: "/etc/bind/named.conf"}},
+		{name: "knot.conf", entry: ServerConfig{KnotConf: "/etc/knot/knot.conf", Server: "ns1.example.com:53"}},
+		{name: "no file", entry: ServerConfig{}, wantErr: "must set one of named_conf and knot_conf"},
+		{name: "two files", entry: ServerConfig{NamedConf: "named.conf", KnotConf: "knot.conf"}, wantErr: "must set one of named_conf and knot_conf"},
+		{name: "unknown key", entry: ServerConfig{NamedConf: "named.conf", Key: "missing."}, wantErr: "which no [[keys]] section defines"},
+		{name: "negative refresh", entry: ServerConfig{NamedConf: "named.conf", Refresh: -time.Minute}, wantErr: "refresh must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewDNSSECExporter(time.Second, []string{"127.0.0.1:53"}, nullLogger())
+			e.ServerConfigs = []ServerConfig{tt.entry}
+
+			err := e.Validate()
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected an error that contains %q, got nil", tt.wantErr)
+				}
+
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error that contains %q, got: %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		})
+	}
+
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
+	"slices"
 	"time"
 
 	"github.com/miekg/dns"
@@ -12,37 +14,325 @@ import (
 // between the two clocks. 300 is the value that BIND and Knot use.
 const tsigFudge = 300
 
-// signature is the RRSIG in a zone that expires first, and the record it covers.
+// signature is an RRSIG, and the record it covers.
 type signature struct {
 	record     string
 	recordType string
+	keyTag     uint16
+	algorithm  uint8
+	signer     string
 	expires    time.Time
 }
 
-// transfer reads a whole zone over AXFR and returns the signature that expires
-// first. The caller decides what an error means for the metrics.
-func (e *Exporter) transfer(ctx context.Context, zone Zone, server string) (signature, error) {
-	var earliest signature
+// newSignature returns the signature of rrsig.
+func newSignature(rrsig *dns.RRSIG) signature {
+	return signature{
+		record:     rrsig.Hdr.Name,
+		recordType: dns.TypeToString[rrsig.TypeCovered],
+		keyTag:     rrsig.KeyTag,
+		algorithm:  rrsig.Algorithm,
+		signer:     rrsig.SignerName,
+		expires:    time.Unix(int64(rrsig.Expiration), 0),
+	}
+}
+
+// sameSeries reports whether s and other would be reported with the same
+// labels: they cover the same record and type, with the same key.
+func (s signature) sameSeries(other signature) bool {
+	return s.keyTag == other.keyTag &&
+		s.recordType == other.recordType &&
+		dns.CanonicalName(s.record) == dns.CanonicalName(other.record)
+}
+
+// addEarliest adds sig to earliest, the signatures that expire first in
+// order, if it is among the first n. A signature of the same series as one in
+// earliest replaces it only when it expires before it, so no two signatures in
+// earliest have the same labels.
+func addEarliest(earliest []signature, sig signature, n int) []signature {
+	if n == 0 || len(earliest) == n && !sig.expires.Before(earliest[n-1].expires) {
+		return earliest
+	}
+
+	if i := slices.IndexFunc(earliest, sig.sameSeries); i >= 0 {
+		if !sig.expires.Before(earliest[i].expires) {
+			return earliest
+		}
+
+		earliest = slices.Delete(earliest, i, i+1)
+	}
+
+	i, _ := slices.BinarySearchFunc(earliest, sig, func(a, b signature) int {
+		return a.expires.Compare(b.expires)
+	})
+
+	earliest = slices.Insert(earliest, i, sig)
+	if len(earliest) > n {
+		earliest = earliest[:n]
+	}
+
+	return earliest
+}
+
+// coveredKinds groups the types an RRSIG covers into the kinds that the
+// earliest signature is reported for. A signer often signs the DNSKEY with
+// another key, and the denial of existence on another schedule, than the rest
+// of the zone. Any other type is of the kind "other".
+var coveredKinds = map[uint16]string{
+	dns.TypeDNSKEY: "DNSKEY",
+	dns.TypeSOA:    "SOA",
+	dns.TypeNSEC:   "NSEC",
+	dns.TypeNSEC3:  "NSEC3",
+}
+
+// coveredKind returns the kind of the type an RRSIG covers.
+func coveredKind(covered uint16) string {
+	if kind, ok := coveredKinds[covered]; ok {
+		return kind
+	}
+
+	return "other"
+}
+
+// daysLeftBuckets are the upper bounds, in days left, of the histogram of the
+// signatures in a zone. The first counts the signatures that have expired.
+var daysLeftBuckets = []float64{0, 1, 3, 7, 14, 21, 30, 60, 90}
+
+// daysLeftHistogram counts the signatures in a zone by the days they have
+// left, in the form of a constant histogram.
+type daysLeftHistogram struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+func (h *daysLeftHistogram) observe(days float64) {
+	h.count++
+	h.sum += days
+
+	for _, bound := range daysLeftBuckets {
+		if days <= bound {
+			h.buckets[bound]++
+		}
+	}
+}
+
+// expiringDays are the windows, in days, that the signatures expiring within
+// are counted for.
+var expiringDays = []int{1, 7, 30}
+
+// zoneStats is what a transfer found in a zone.
+type zoneStats struct {
+	// earliest is the signature that expires first, or has a zero expiry when
+	// no record is signed.
+	earliest signature
+
+	// earliestByKind is the signature that expires first of each kind of
+	// covered type that the zone has signatures of.
+	earliestByKind map[string]signature
+
+	// signatures are the signatures that expire first, earliest first, as many
+	// as the zone asks for.
+	signatures []signature
+
+	// daysLeft counts the signatures by the days they have left.
+	daysLeft daysLeftHistogram
+
+	serial uint32
+	rrsets int
+	rrsigs int
+
+	// records counts the records of each type, by its name.
+	records map[string]int
+
+	// expiring counts the signatures that expire within each of expiringDays,
+	// including those that have expired already.
+	expiring []int
+
+	// orphaned counts the RRSIGs by the zone made by a key that the DNSKEY set
+	// of the zone does not have.
+	orphaned int
+
+	// zonemd is the verification of the ZONEMD of the zone, or nil when the
+	// zone does not ask for it.
+	zonemd *zonemdResult
+
+	// size is the size of the transfer on the wire.
+	size transferSize
+}
+
+// transferSize is the number of messages and bytes a transfer read.
+type transferSize struct {
+	messages int
+	bytes    int64
+}
+
+// transfer reads a whole zone over AXFR and returns what it found, including
+// the signature that expires first. The caller decides what an error means for
+// the metrics.
+func (e *Exporter) transfer(ctx context.Context, zone Zone, server string) (zoneStats, error) {
+	now := time.Now()
+
+	stats := zoneStats{
+		records:        make(map[string]int),
+		expiring:       make([]int, len(expiringDays)),
+		daysLeft:       daysLeftHistogram{buckets: make(map[float64]uint64, len(daysLeftBuckets))},
+		earliestByKind: make(map[string]signature, len(coveredKinds)+1),
+	}
+
+	rrsets := make(map[string]bool)
+
+	// The DNSKEY set can come after the RRSIGs it made, so the RRSIGs are
+	// counted by key until the whole zone is read.
+	apex := dns.CanonicalName(zone.Zone)
+	keys := make(map[keyID]bool)
+	signedBy := make(map[keyID]int)
+
+	var (
+		soaSeen bool
+		digest  *zoneDigest
+	)
+
+	if zone.VerifyZONEMD {
+		digest = newZoneDigest(zone.Zone)
+	}
+
+	size, err := e.axfr(ctx, zone.Zone, zone.Key, server, func(rr dns.RR) {
+		hdr := rr.Header()
+
+		// A transfer ends with the SOA it started with, which is not a second
+		// record.
+		if soa, ok := rr.(*dns.SOA); ok {
+			if soaSeen {
+				return
+			}
+
+			soaSeen = true
+			stats.serial = soa.Serial
+		}
 
+		if digest != nil {
+			digest.add(rr)
+		}
+
+		if key, ok := rr.(*dns.DNSKEY); ok && dns.CanonicalName(hdr.Name) == apex {
+			keys[keyID{tag: key.KeyTag(), algorithm: key.Algorithm}] = true
+		}
+
+		recordType := dns.TypeToString[hdr.Rrtype]
+
+		stats.records[recordType]++
+
+		// RRSIGs are counted on their own, so the RRsets are those of the
+		// records that the RRSIGs sign.
+		rrsig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			rrsets[dns.CanonicalName(hdr.Name)+" "+recordType] = true
+			return
+		}
+
+		stats.rrsigs++
+
+		sig := newSignature(rrsig)
+		expires := sig.expires
+
+		if dns.CanonicalName(sig.signer) == apex {
+			signedBy[sig.key()]++
+		}
+
+		for i, days := range expiringDays {
+			if expires.Before(now.AddDate(0, 0, days)) {
+				stats.expiring[i]++
+			}
+		}
+
+		stats.daysLeft.observe(expires.Sub(now).Hours() / 24)
+
+		stats.signatures = addEarliest(stats.signatures, sig, zone.EarliestSignatures)
+
+		if stats.earliest.expires.IsZero() || expires.Before(stats.earliest.expires) {
+			stats.earliest = sig
+		}
+
+		kind := coveredKind(rrsig.TypeCovered)
+		if first, ok := stats.earliestByKind[kind]; !ok || expires.Before(first.expires) {
+			stats.earliestByKind[kind] = sig
+		}
+	})
+	if err != nil {
+		return zoneStats{}, err
+	}
+
+	stats.rrsets = len(rrsets)
+
+	if digest != nil {
+		result := digest.verify()
+		stats.zonemd = &result
+	}
+
+	for key, count := range signedBy {
+		if !keys[key] {
+			stats.orphaned += count
+		}
+	}
+	stats.size = size
+
+	return stats, nil
+}
+
+// axfr transfers zone from server, signed with the named key if there is one,
+// and calls fn with every record in the order the server sends them. fn may
+// have seen part of the zone when axfr returns an error.
+func (e *Exporter) axfr(ctx context.Context, zone, keyName, server string, fn func(dns.RR)) (transferSize, error) {
 	msg := &dns.Msg{}
-	msg.SetAxfr(dns.Fqdn(zone.Zone))
+	msg.SetAxfr(dns.Fqdn(zone))
 
 	tr := &dns.Transfer{
-		DialTimeout:  e.timeout,
 		ReadTimeout:  e.timeout,
 		WriteTimeout: e.timeout,
 	}
 
-	if zone.Key != "" {
-		key := e.keys[dns.Fqdn(zone.Key)]
+	if keyName != "" {
+		key := e.keys[dns.Fqdn(keyName)]
 
 		tr.TsigSecret = map[string]string{key.Name: key.Secret}
 		msg.SetTsig(key.Name, key.Algorithm, tsigFudge, time.Now().Unix())
 	}
 
+	var size transferSize
+
+	done, err := e.limits.acquire(ctx, server)
+	if err != nil {
+		return size, fmt.Errorf("wait for the query limits: %w", err)
+	}
+	defer done()
+
+	// Like a query, the transfer has the timeout from when it starts.
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		e.instruments.transferDuration.WithLabelValues(server).Observe(time.Since(start).Seconds())
+	}()
+
+	// The exporter dials the server itself, rather than let the library do it,
+	// to count the bytes it reads.
+	dialer := &net.Dialer{Timeout: e.timeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return size, fmt.Errorf("start transfer: %w", err)
+	}
+
+	counted := &countingConn{Conn: conn}
+	tr.Conn = &dns.Conn{Conn: counted}
+
 	envelopes, err := tr.In(msg, server)
 	if err != nil {
-		return earliest, fmt.Errorf("start transfer: %w", err)
+		// The library closes the connection only once the transfer has started.
+		_ = conn.Close()
+
+		return size, fmt.Errorf("start transfer: %w", err)
 	}
 
 	// The channel must be drained to the end, or the reading goroutine inside
@@ -66,28 +356,38 @@ func (e *Exporter) transfer(ctx context.Context, zone Zone, server string) (sign
 			continue
 		}
 
-		for _, rr := range envelope.RR {
-			rrsig, ok := rr.(*dns.RRSIG)
-			if !ok {
-				continue
-			}
+		if transferErr != nil {
+			continue
+		}
 
-			expires := time.Unix(int64(rrsig.Expiration), 0)
-			if !earliest.expires.IsZero() && !expires.Before(earliest.expires) {
-				continue
-			}
+		// Each envelope holds the records of one message.
+		size.messages++
 
-			earliest = signature{
-				record:     rrsig.Hdr.Name,
-				recordType: dns.TypeToString[rrsig.TypeCovered],
-				expires:    expires,
-			}
+		for _, rr := range envelope.RR {
+			fn(rr)
 		}
 	}
 
+	// The library closes the connection before the channel, so the count is
+	// final.
+	size.bytes = counted.read
+
 	if transferErr != nil {
-		return signature{}, fmt.Errorf("read zone: %w", transferErr)
+		return size, fmt.Errorf("read zone: %w", transferErr)
 	}
 
-	return earliest, nil
+	return size, nil
+}
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+	read int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read += int64(n)
+
+	return n, err
 }
@@ -4,11 +4,13 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -26,6 +28,10 @@ type zoneOpts struct {
 
 	// unsigned serves the zone without any RRSIG.
 	unsigned bool
+
+	// zones are more zones to serve over AXFR by name, such as a catalog. Each
+	// is sent as it is, so it must start and end with its SOA.
+	zones map[string][]dns.RR
 }
 
 // runZoneServer serves example.com over AXFR. It returns the server address and
@@ -96,6 +102,13 @@ func runZoneServer(t *testing.T, opts zoneOpts) (string, func()) {
 	records = append(records, soa)
 
 	h := dns.NewServeMux()
+
+	for name, rrs := range opts.zones {
+		h.HandleFunc(name, func(rw dns.ResponseWriter, msg *dns.Msg) {
+			serveZone(t, rw, msg, rrs)
+		})
+	}
+
 	h.HandleFunc(zone, func(rw dns.ResponseWriter, msg *dns.Msg) {
 
 		if opts.refuse {
@@ -109,17 +122,7 @@ func runZoneServer(t *testing.T, opts zoneOpts) (string, func()) {
 			return
 		}
 
-		tr := &dns.Transfer{}
-		envelopes := make(chan *dns.Envelope)
-
-		go func() {
-			envelopes <- &dns.Envelope{RR: records}
-			close(envelopes)
-		}()
-
-		if err := tr.Out(rw, msg, envelopes); err != nil {
-			t.Errorf("couldn't write zone: %v", err)
-		}
+		serveZone(t, rw, msg, records)
 
 	})
 
@@ -152,6 +155,23 @@ func runZoneServer(t *testing.T, opts zoneOpts) (string, func()) {
 
 }
 
+// serveZone answers an AXFR request with records.
+func serveZone(t *testing.T, rw dns.ResponseWriter, msg *dns.Msg, records []dns.RR) {
+
+	tr := &dns.Transfer{}
+	envelopes := make(chan *dns.Envelope)
+
+	go func() {
+		envelopes <- &dns.Envelope{RR: records}
+		close(envelopes)
+	}()
+
+	if err := tr.Out(rw, msg, envelopes); err != nil {
+		t.Errorf("couldn't write zone: %v", err)
+	}
+
+}
+
 // zoneExporter builds an exporter for a single zone and runs Validate, so the
 // key index is built the same way it is at start.
 func zoneExporter(t *testing.T, zone Zone, keys []Key) *Exporter {
@@ -199,6 +219,263 @@ dnssec_zone_transfer_success{server="` + addr + `",zone="example.com"} 1
 
 }
 
+// The statistics must count the zone as it is, without the SOA that a transfer
+// repeats at its end.
+func TestZoneTransferReportsStats(t *testing.T) {
+
+	now := time.Now()
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{
+			now.Add(12 * time.Hour),
+			now.Add(3 * 24 * time.Hour),
+			now.Add(20 * 24 * time.Hour),
+			now.Add(100 * 24 * time.Hour),
+		},
+	})
+
+	defer cancel()
+
+	e := zoneExporter(t, Zone{Zone: "example.com", Server: addr}, nil)
+
+	expected := `
+# HELP dnssec_zone_records Number of records of the type in the zone transferred from the configured server
+# TYPE dnssec_zone_records gauge
+dnssec_zone_records{server="` + addr + `",type="A",zone="example.com"} 4
+dnssec_zone_records{server="` + addr + `",type="RRSIG",zone="example.com"} 4
+dnssec_zone_records{server="` + addr + `",type="SOA",zone="example.com"} 1
+# HELP dnssec_zone_rrsets Number of RRsets in the zone transferred from the configured server, not counting RRSIGs
+# TYPE dnssec_zone_rrsets gauge
+dnssec_zone_rrsets{server="` + addr + `",zone="example.com"} 5
+# HELP dnssec_zone_rrsigs Number of RRSIG records in the zone transferred from the configured server
+# TYPE dnssec_zone_rrsigs gauge
+dnssec_zone_rrsigs{server="` + addr + `",zone="example.com"} 4
+# HELP dnssec_zone_signatures_expiring Number of RRSIGs in the zone transferred from the configured server that expire within the days
+# TYPE dnssec_zone_signatures_expiring gauge
+dnssec_zone_signatures_expiring{days="1",server="` + addr + `",zone="example.com"} 1
+dnssec_zone_signatures_expiring{days="30",server="` + addr + `",zone="example.com"} 3
+dnssec_zone_signatures_expiring{days="7",server="` + addr + `",zone="example.com"} 2
+# HELP dnssec_zone_soa_serial Serial of the SOA of the zone transferred from the configured server
+# TYPE dnssec_zone_soa_serial gauge
+dnssec_zone_soa_serial{server="` + addr + `",zone="example.com"} 1
+# HELP dnssec_zone_transfer_messages Number of DNS messages the zone transfer from the configured server read
+# TYPE dnssec_zone_transfer_messages gauge
+dnssec_zone_transfer_messages{server="` + addr + `",zone="example.com"} 1
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"dnssec_zone_records", "dnssec_zone_rrsets", "dnssec_zone_rrsigs", "dnssec_zone_signatures_expiring",
+		"dnssec_zone_soa_serial", "dnssec_zone_transfer_messages"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+	if got := testutil.ToFloat64(collectOne(t, e, "dnssec_zone_transfer_bytes")); got <= 0 {
+		t.Fatalf("transfer_bytes = %v, want the size of the transfer", got)
+	}
+
+}
+
+func TestAddEarliest(t *testing.T) {
+
+	sig := func(record string, keyTag uint16, expires int64) signature {
+		return signature{record: record, recordType: "A", keyTag: keyTag, expires: time.Unix(expires, 0)}
+	}
+
+	var earliest []signature
+
+	for _, s := range []signature{
+		sig("a.example.com.", 1, 300),
+		sig("b.example.com.", 1, 100),
+		sig("c.example.com.", 1, 400),
+		sig("d.example.com.", 1, 200),
+		// The same series as b, but later, so b stays.
+		sig("B.example.com.", 1, 150),
+		// The same series as a, and earlier, so it replaces a.
+		sig("a.example.com.", 1, 50),
+	} {
+		earliest = addEarliest(earliest, s, 3)
+	}
+
+	want := []signature{sig("a.example.com.", 1, 50), sig("b.example.com.", 1, 100), sig("d.example.com.", 1, 200)}
+
+	if !slices.Equal(earliest, want) {
+		t.Fatalf("earliest = %v, want %v", earliest, want)
+	}
+
+	if got := addEarliest(nil, sig("a.example.com.", 1, 50), 0); got != nil {
+		t.Fatalf("a zone that asks for no signatures got %v", got)
+	}
+
+}
+
+// A zone that asks for its earliest signatures gets that many series, and the
+// histogram counts every signature in the zone.
+func TestZoneTransferReportsEarliestSignatures(t *testing.T) {
+
+	now := time.Now()
+
+	addr, cancel := runZoneServer(t, zoneOpts{
+		expirations: []time.Time{
+			now.Add(12 * time.Hour),
+			now.Add(5 * 24 * time.Hour),
+			now.Add(100 * 24 * time.Hour),
+		},
+	})
+
+	defer cancel()
+
+	e := zoneExporter(t, Zone{Zone: "example.com", Server: addr, EarliestSignatures: 2}, nil)
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_signature_expiry"); n != 2 {
+		t.Fatalf("expected two signature_expiry series, got %d", n)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(e)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("couldn't gather metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "dnssec_zone_signature_days_left" {
+			continue
+		}
+
+		histogram := family.GetMetric()[0].GetHistogram()
+
+		if histogram.GetSampleCount() != 3 {
+			t.Fatalf("histogram count = %d, want 3", histogram.GetSampleCount())
+		}
+
+		buckets := make(map[float64]uint64)
+		for _, bucket := range histogram.GetBucket() {
+			buckets[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+		}
+
+		// The signature of a0 expires within a day, and that of a1 within 7.
+		// The one of a2 is past the last bucket.
+		for bound, want := range map[float64]uint64{0: 0, 1: 1, 7: 2, 90: 2} {
+			if buckets[bound] != want {
+				t.Fatalf("bucket %v = %d, want %d", bound, buckets[bound], want)
+			}
+		}
+
+		return
+	}
+
+	t.Fatal("dnssec_zone_signature_days_left was not reported")
+
+}
+
+// The DNSKEY signature must be reported even when a record of another type
+// expires first, because a signer often re-signs the DNSKEY on its own
+// schedule.
+func TestZoneTransferReportsEarliestByKind(t *testing.T) {
+
+	const zone = "example.net."
+
+	rrsig := func(name string, covered uint16, expires int64) *dns.RRSIG {
+		return &dns.RRSIG{
+			Hdr:         dns.RR_Header{Name: name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+			TypeCovered: covered,
+			Algorithm:   dns.ECDSAP256SHA256,
+			Expiration:  uint32(expires),
+			SignerName:  zone,
+		}
+	}
+
+	soa := &dns.SOA{
+		Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Ns:     "ns1." + zone,
+		Mbox:   "test." + zone,
+		Serial: 1,
+	}
+
+	addr, cancel := runZoneServer(t, zoneOpts{zones: map[string][]dns.RR{zone: {
+		soa,
+		rrsig(zone, dns.TypeSOA, 2100000000),
+		rrsig(zone, dns.TypeDNSKEY, 2050000000),
+		rrsig(zone, dns.TypeNSEC, 2200000000),
+		rrsig("a."+zone, dns.TypeA, 2000000000),
+		rrsig("b."+zone, dns.TypeA, 2010000000),
+		rrsig("a."+zone, dns.TypeNSEC, 2150000000),
+		soa,
+	}}})
+
+	defer cancel()
+
+	e := zoneExporter(t, Zone{Zone: "example.net", Server: addr}, nil)
+
+	expected := `
+# HELP dnssec_zone_earliest_rrsig_expiry Earliest expiring RRSIG covering a type of the kind in the zone transferred from the configured server in unixtime
+# TYPE dnssec_zone_earliest_rrsig_expiry gauge
+dnssec_zone_earliest_rrsig_expiry{covered="DNSKEY",record="example.net.",server="` + addr + `",type="DNSKEY",zone="example.net"} 2.05e+09
+dnssec_zone_earliest_rrsig_expiry{covered="NSEC",record="a.example.net.",server="` + addr + `",type="NSEC",zone="example.net"} 2.15e+09
+dnssec_zone_earliest_rrsig_expiry{covered="SOA",record="example.net.",server="` + addr + `",type="SOA",zone="example.net"} 2.1e+09
+dnssec_zone_earliest_rrsig_expiry{covered="other",record="a.example.net.",server="` + addr + `",type="A",zone="example.net"} 2e+09
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "dnssec_zone_earliest_rrsig_expiry"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+}
+
+// The DNSKEY set can come after the signatures it made, and the orphaned
+// signatures must be counted all the same.
+func TestZoneTransferOrphanedRRSIGs(t *testing.T) {
+
+	const zone = "example.net."
+
+	soa := &dns.SOA{
+		Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Ns:     "ns1." + zone,
+		Mbox:   "test." + zone,
+		Serial: 1,
+	}
+
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Algorithm: dns.ECDSAP256SHA256,
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		PublicKey: "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==",
+	}
+
+	rrsig := func(name string, keyTag uint16, signer string) *dns.RRSIG {
+		return &dns.RRSIG{
+			Hdr:         dns.RR_Header{Name: name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+			TypeCovered: dns.TypeA,
+			Algorithm:   dns.ECDSAP256SHA256,
+			Expiration:  2000000000,
+			KeyTag:      keyTag,
+			SignerName:  signer,
+		}
+	}
+
+	addr, cancel := runZoneServer(t, zoneOpts{zones: map[string][]dns.RR{zone: {
+		soa,
+		rrsig("a."+zone, dnskey.KeyTag(), zone),
+		rrsig("b."+zone, dnskey.KeyTag()+1, zone),
+		rrsig("c."+zone, dnskey.KeyTag()+1, zone),
+		// Signed by another zone, whose keys the transfer does not have.
+		rrsig("d."+zone, dnskey.KeyTag()+2, "example.org."),
+		dnskey,
+		soa,
+	}}})
+
+	defer cancel()
+
+	e := zoneExporter(t, Zone{Zone: "example.net", Server: addr}, nil)
+
+	if got := testutil.ToFloat64(collectOne(t, e, "dnssec_zone_orphaned_rrsigs")); got != 2 {
+		t.Fatalf("orphaned_rrsigs = %v, want 2", got)
+	}
+
+}
+
 func TestZoneTransferWithTSIG(t *testing.T) {
 
 	const (
@@ -243,6 +520,12 @@ func TestZoneTransferWrongTSIGSecret(t *testing.T) {
 	)
 
 	expected := `
+# HELP dnssec_zone_transfer_consecutive_failures Number of transfers of the zone from the configured server that found no signature since the last that did
+# TYPE dnssec_zone_transfer_consecutive_failures gauge
+dnssec_zone_transfer_consecutive_failures{server="` + addr + `",zone="example.com"} 1
+# HELP dnssec_zone_transfer_error Why the zone transfer from the configured server gave no signature to check
+# TYPE dnssec_zone_transfer_error gauge
+dnssec_zone_transfer_error{reason="tsig_error",server="` + addr + `",zone="example.com"} 1
 # HELP dnssec_zone_transfer_success Did the zone transfer from the configured server succeed
 # TYPE dnssec_zone_transfer_success gauge
 dnssec_zone_transfer_success{server="` + addr + `",zone="example.com"} 0
@@ -264,6 +547,12 @@ func TestZoneTransferRefused(t *testing.T) {
 	e := zoneExporter(t, Zone{Zone: "example.com", Server: addr}, nil)
 
 	expected := `
+# HELP dnssec_zone_transfer_consecutive_failures Number of transfers of the zone from the configured server that found no signature since the last that did
+# TYPE dnssec_zone_transfer_consecutive_failures gauge
+dnssec_zone_transfer_consecutive_failures{server="` + addr + `",zone="example.com"} 1
+# HELP dnssec_zone_transfer_error Why the zone transfer from the configured server gave no signature to check
+# TYPE dnssec_zone_transfer_error gauge
+dnssec_zone_transfer_error{reason="refused",server="` + addr + `",zone="example.com"} 1
 # HELP dnssec_zone_transfer_success Did the zone transfer from the configured server succeed
 # TYPE dnssec_zone_transfer_success gauge
 dnssec_zone_transfer_success{server="` + addr + `",zone="example.com"} 0
@@ -295,4 +584,8 @@ func TestZoneTransferUnsignedZone(t *testing.T) {
 		t.Fatalf("expected no expiry series for an unsigned zone, got %d", count)
 	}
 
+	if count := testutil.CollectAndCount(e, "dnssec_zone_transfer_error"); count != 1 {
+		t.Fatalf("expected a transfer_error series for an unsigned zone, got %d", count)
+	}
+
 }
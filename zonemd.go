@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// zonemdHashes are the hash algorithms of the SIMPLE scheme of ZONEMD
+// (RFC 8976) that the exporter verifies.
+var zonemdHashes = map[uint8]func() hash.Hash{
+	dns.ZoneMDHashAlgSHA384: sha512.New384,
+	dns.ZoneMDHashAlgSHA512: sha512.New,
+}
+
+// zonemdMinDigest is the shortest digest RFC 8976 allows. A ZONEMD with a
+// shorter one cannot verify the zone.
+const zonemdMinDigest = 12
+
+// zoneDigest keeps the records of a zone during a transfer, in canonical form,
+// to verify the ZONEMD of the zone at the end. The digest covers the zone in
+// canonical order, which a transfer does not keep, so it needs every record.
+type zoneDigest struct {
+	apex    string
+	serial  uint32
+	zonemds []*dns.ZONEMD
+	records []digestRecord
+	err     error
+}
+
+// digestRecord is a record in canonical form, with what it sorts by.
+type digestRecord struct {
+	// labels are the labels of the owner name, lowercase, the rightmost first.
+	labels [][]byte
+	class  uint16
+	rrtype uint16
+
+	// wire is the whole record, and rdata the part of it after the header.
+	wire  []byte
+	rdata []byte
+}
+
+func newZoneDigest(zone string) *zoneDigest {
+	return &zoneDigest{apex: dns.CanonicalName(zone)}
+}
+
+// add adds a record of the zone. The ZONEMD RRset at the apex, and the RRSIGs
+// that cover it, are not part of the digest.
+func (d *zoneDigest) add(rr dns.RR) {
+	hdr := rr.Header()
+	apex := dns.CanonicalName(hdr.Name) == d.apex
+
+	switch rr := rr.(type) {
+	case *dns.SOA:
+		if apex {
+			d.serial = rr.Serial
+		}
+
+	case *dns.ZONEMD:
+		if apex {
+			d.zonemds = append(d.zonemds, rr)
+			return
+		}
+
+	case *dns.RRSIG:
+		if apex && rr.TypeCovered == dns.TypeZONEMD {
+			return
+		}
+	}
+
+	if d.err != nil {
+		return
+	}
+
+	rec, err := newDigestRecord(rr)
+	if err != nil {
+		d.err = err
+		return
+	}
+
+	d.records = append(d.records, rec)
+}
+
+// newDigestRecord returns rr in canonical form (RFC 4034, section 6.2).
+func newDigestRecord(rr dns.RR) (digestRecord, error) {
+	rr = dns.Copy(rr)
+	hdr := rr.Header()
+	hdr.Name = dns.CanonicalName(hdr.Name)
+
+	canonicalRdata(rr)
+
+	wire := make([]byte, dns.Len(rr)+1)
+
+	off, err := dns.PackRR(rr, wire, 0, nil, false)
+	if err != nil {
+		return digestRecord{}, err
+	}
+
+	wire = wire[:off]
+
+	// The header is the owner name followed by the type, class, TTL and
+	// rdata length, which take 10 bytes.
+	name := make([]byte, 256)
+
+	nameLen, err := dns.PackDomainName(hdr.Name, name, 0, nil, false)
+	if err != nil {
+		return digestRecord{}, err
+	}
+
+	return digestRecord{
+		labels: reversedLabels(name[:nameLen]),
+		class:  hdr.Class,
+		rrtype: hdr.Rrtype,
+		wire:   wire,
+		rdata:  wire[nameLen+10:],
+	}, nil
+}
+
+// canonicalRdata lowercases the domain names in the rdata of rr, for the types
+// that RFC 4034 lists, as RFC 6840 corrects it: not HINFO, and not NSEC.
+func canonicalRdata(rr dns.RR) {
+	switch rr := rr.(type) {
+	case *dns.NS:
+		rr.Ns = dns.CanonicalName(rr.Ns)
+	case *dns.MD:
+		rr.Md = dns.CanonicalName(rr.Md)
+	case *dns.MF:
+		rr.Mf = dns.CanonicalName(rr.Mf)
+	case *dns.CNAME:
+		rr.Target = dns.CanonicalName(rr.Target)
+	case *dns.SOA:
+		rr.Ns = dns.CanonicalName(rr.Ns)
+		rr.Mbox = dns.CanonicalName(rr.Mbox)
+	case *dns.MB:
+		rr.Mb = dns.CanonicalName(rr.Mb)
+	case *dns.MG:
+		rr.Mg = dns.CanonicalName(rr.Mg)
+	case *dns.MR:
+		rr.Mr = dns.CanonicalName(rr.Mr)
+	case *dns.PTR:
+		rr.Ptr = dns.CanonicalName(rr.Ptr)
+	case *dns.MINFO:
+		rr.Rmail = dns.CanonicalName(rr.Rmail)
+		rr.Email = dns.CanonicalName(rr.Email)
+	case *dns.MX:
+		rr.Mx = dns.CanonicalName(rr.Mx)
+	case *dns.RP:
+		rr.Mbox = dns.CanonicalName(rr.Mbox)
+		rr.Txt = dns.CanonicalName(rr.Txt)
+	case *dns.AFSDB:
+		rr.Hostname = dns.CanonicalName(rr.Hostname)
+	case *dns.RT:
+		rr.Host = dns.CanonicalName(rr.Host)
+	case *dns.SIG:
+		rr.SignerName = dns.CanonicalName(rr.SignerName)
+	case *dns.RRSIG:
+		rr.SignerName = dns.CanonicalName(rr.SignerName)
+	case *dns.PX:
+		rr.Map822 = dns.CanonicalName(rr.Map822)
+		rr.Mapx400 = dns.CanonicalName(rr.Mapx400)
+	case *dns.NAPTR:
+		rr.Replacement = dns.CanonicalName(rr.Replacement)
+	case *dns.KX:
+		rr.Exchanger = dns.CanonicalName(rr.Exchanger)
+	case *dns.SRV:
+		rr.Target = dns.CanonicalName(rr.Target)
+	case *dns.DNAME:
+		rr.Target = dns.CanonicalName(rr.Target)
+	}
+}
+
+// reversedLabels splits a name in wire form into its labels, the rightmost
+// first, leaving out the root.
+func reversedLabels(name []byte) [][]byte {
+	var labels [][]byte
+
+	for off := 0; off < len(name) && name[off] != 0; off += int(name[off]) + 1 {
+		labels = append(labels, name[off+1:off+1+int(name[off])])
+	}
+
+	slices.Reverse(labels)
+
+	return labels
+}
+
+// compareDigestRecords orders records by owner name in canonical order, then
+// class, type and rdata (RFC 8976, section 3.3.1).
+func compareDigestRecords(a, b digestRecord) int {
+	if c := slices.CompareFunc(a.labels, b.labels, bytes.Compare); c != 0 {
+		return c
+	}
+
+	return cmp.Or(
+		cmp.Compare(a.class, b.class),
+		cmp.Compare(a.rrtype, b.rrtype),
+		bytes.Compare(a.rdata, b.rdata),
+	)
+}
+
+// digest returns the SIMPLE digest of the zone with the hash of algorithm. A
+// record that the zone has twice is counted once.
+func (d *zoneDigest) digest(algorithm uint8) []byte {
+	slices.SortFunc(d.records, compareDigestRecords)
+
+	h := zonemdHashes[algorithm]()
+
+	for i, rec := range d.records {
+		if i > 0 && bytes.Equal(rec.wire, d.records[i-1].wire) {
+			continue
+		}
+
+		h.Write(rec.wire)
+	}
+
+	return h.Sum(nil)
+}
+
+// zonemdResult is the outcome of the verification of the ZONEMD of a zone.
+type zonemdResult struct {
+	// present is whether the zone has a ZONEMD at its apex, and serial the
+	// serial of the first.
+	present bool
+	serial  uint32
+
+	// verified is whether a ZONEMD that the exporter can verify matches the
+	// zone.
+	verified bool
+}
+
+// verify checks the zone against its ZONEMD RRset (RFC 8976, section 4). The
+// zone verifies when one ZONEMD of the SIMPLE scheme, with a hash the exporter
+// supports, has the serial of the SOA and the digest of the zone. A scheme and
+// hash that the RRset has twice cannot verify the zone.
+func (d *zoneDigest) verify() zonemdResult {
+	if len(d.zonemds) == 0 {
+		return zonemdResult{}
+	}
+
+	result := zonemdResult{present: true, serial: d.zonemds[0].Serial}
+
+	if d.err != nil {
+		return result
+	}
+
+	type schemeHash struct{ scheme, hash uint8 }
+
+	seen := make(map[schemeHash]int, len(d.zonemds))
+	for _, zonemd := range d.zonemds {
+		seen[schemeHash{zonemd.Scheme, zonemd.Hash}]++
+	}
+
+	digests := make(map[uint8][]byte, len(zonemdHashes))
+
+	for _, zonemd := range d.zonemds {
+		if zonemd.Scheme != dns.ZoneMDSchemeSimple || zonemdHashes[zonemd.Hash] == nil {
+			continue
+		}
+
+		if seen[schemeHash{zonemd.Scheme, zonemd.Hash}] > 1 || zonemd.Serial != d.serial {
+			continue
+		}
+
+		published, err := hex.DecodeString(zonemd.Digest)
+		if err != nil || len(published) < zonemdMinDigest {
+			continue
+		}
+
+		computed, ok := digests[zonemd.Hash]
+		if !ok {
+			computed = d.digest(zonemd.Hash)
+			digests[zonemd.Hash] = computed
+		}
+
+		if bytes.Equal(published, computed) {
+			result.verified = true
+			return result
+		}
+	}
+
+	return result
+}
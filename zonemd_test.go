@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// simpleExample is the zone of the simple example of RFC 8976, appendix A.1,
+// with its SHA384 ZONEMD.
+var simpleExample = []string{
+	"example. 86400 IN SOA ns1.example. admin.example. 2018031900 1800 900 604800 86400",
+	"example. 86400 IN NS ns1.example.",
+	"example. 86400 IN NS ns2.example.",
+	"example. 86400 IN ZONEMD 2018031900 1 1 c68090d90a7aed716bc459f9340e3d7c1370d4d24b7e2fc3a1ddc0b9a87153b9a9713b3c9ae5cc27777f98b8e730044c",
+	"ns1.example. 3600 IN A 203.0.113.63",
+	"ns2.example. 3600 IN AAAA 2001:db8::63",
+}
+
+func parseZone(t *testing.T, lines []string) []dns.RR {
+
+	records := make([]dns.RR, 0, len(lines))
+
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatalf("couldn't parse %q: %v", line, err)
+		}
+
+		records = append(records, rr)
+	}
+
+	return records
+}
+
+func digestOf(t *testing.T, lines []string) *zoneDigest {
+
+	d := newZoneDigest("example.")
+	for _, rr := range parseZone(t, lines) {
+		d.add(rr)
+	}
+
+	return d
+}
+
+// replaced returns the example with the line that starts with prefix replaced.
+func replaced(prefix, line string) []string {
+
+	lines := make([]string, 0, len(simpleExample))
+
+	for _, l := range simpleExample {
+		if strings.HasPrefix(l, prefix) {
+			l = line
+		}
+
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	return lines
+}
+
+func TestZONEMDVerify(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  zonemdResult
+	}{
+		{"RFC 8976 simple example", simpleExample, zonemdResult{present: true, serial: 2018031900, verified: true}},
+		{
+			"the records in another order and case",
+			[]string{
+				simpleExample[5],
+				"NS1.Example. 3600 IN A 203.0.113.63",
+				simpleExample[3],
+				"example. 86400 IN NS NS2.example.",
+				simpleExample[0],
+				simpleExample[1],
+				// A record that the zone has twice is counted once.
+				simpleExample[1],
+			},
+			zonemdResult{present: true, serial: 2018031900, verified: true},
+		},
+		{
+			"a changed record",
+			replaced("ns1.example.", "ns1.example. 3600 IN A 203.0.113.64"),
+			zonemdResult{present: true, serial: 2018031900},
+		},
+		{
+			"a missing record",
+			replaced("ns2.example.", ""),
+			zonemdResult{present: true, serial: 2018031900},
+		},
+		{
+			"a serial that is not the serial of the SOA",
+			replaced("example. 86400 IN SOA", "example. 86400 IN SOA ns1.example. admin.example. 2018031901 1800 900 604800 86400"),
+			zonemdResult{present: true, serial: 2018031900},
+		},
+		{
+			"an unknown hash",
+			replaced("example. 86400 IN ZONEMD", "example. 86400 IN ZONEMD 2018031900 1 240 c68090d90a7aed716bc459f9340e3d7c1370d4d24b7e2fc3a1ddc0b9a87153b9a9713b3c9ae5cc27777f98b8e730044c"),
+			zonemdResult{present: true, serial: 2018031900},
+		},
+		{
+			"the digest twice",
+			append(slices.Clone(simpleExample), "example. 86400 IN ZONEMD 2018031900 1 1 "+strings.Repeat("00", 48)),
+			zonemdResult{present: true, serial: 2018031900},
+		},
+		{"no ZONEMD", replaced("example. 86400 IN ZONEMD", ""), zonemdResult{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digestOf(t, tt.lines).verify(); got != tt.want {
+				t.Fatalf("verify = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+}
+
+// A SHA512 ZONEMD verifies the zone as well, and so does an RRSIG covering the
+// ZONEMD, which the digest leaves out.
+func TestZONEMDSHA512(t *testing.T) {
+
+	lines := replaced("example. 86400 IN ZONEMD", "")
+
+	digest := hex.EncodeToString(digestOf(t, lines).digest(dns.ZoneMDHashAlgSHA512))
+
+	lines = append(lines,
+		"example. 86400 IN ZONEMD 2018031900 1 2 "+digest,
+		"example. 86400 IN RRSIG ZONEMD 13 1 86400 20300101000000 20200101000000 12345 example. AAAA",
+	)
+
+	if got := digestOf(t, lines).verify(); !got.verified {
+		t.Fatalf("verify = %+v, want a verified zone", got)
+	}
+
+}
+
+func TestZoneTransferVerifiesZONEMD(t *testing.T) {
+
+	records := parseZone(t, simpleExample)
+
+	// A transfer ends with the SOA repeated, which is not a second record.
+	records = append(records, records[0])
+
+	addr, cancel := runZoneServer(t, zoneOpts{zones: map[string][]dns.RR{"example.": records}})
+	defer cancel()
+
+	e := zoneExporter(t, Zone{Zone: "example", Server: addr, VerifyZONEMD: true}, nil)
+
+	expected := `
+# HELP dnssec_zone_zonemd_serial Serial of the ZONEMD of the zone transferred from the configured server
+# TYPE dnssec_zone_zonemd_serial gauge
+dnssec_zone_zonemd_serial{server="` + addr + `",zone="example"} 2.0180319e+09
+# HELP dnssec_zone_zonemd_verified Does a ZONEMD of the zone transferred from the configured server match the zone
+# TYPE dnssec_zone_zonemd_verified gauge
+dnssec_zone_zonemd_verified{server="` + addr + `",zone="example"} 1
+`
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"dnssec_zone_zonemd_serial", "dnssec_zone_zonemd_verified"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+	// A zone that does not ask for the verification does not get it.
+	e = zoneExporter(t, Zone{Zone: "example", Server: addr}, nil)
+
+	if n := testutil.CollectAndCount(e, "dnssec_zone_zonemd_verified"); n != 0 {
+		t.Fatalf("expected no zonemd_verified series, got %d", n)
+	}
+
+}